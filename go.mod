@@ -5,6 +5,8 @@ go 1.18
 require (
 	github.com/Masterminds/semver/v3 v3.1.0
 	github.com/urfave/cli/v2 v2.2.0
+	golang.org/x/mod v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/americanas-tech/restQL-cli/restql"
 	"github.com/urfave/cli/v2"
@@ -11,8 +14,23 @@ import (
 const defaultRestqlVersion = "v6.2.0"
 
 func main() {
+	// the first interrupt stops the running commands and lets the CLI clean up,
+	// a second one kills them and exits at once
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-signals
+		cancel()
+		<-signals
+		restql.KillCommands()
+		os.Exit(1)
+	}()
+
 	app := newApp()
-	if err := app.Run(os.Args); err != nil {
+	if err := app.RunContext(ctx, os.Args); err != nil {
 		fmt.Printf("[ERROR] failed to initialize RestQL CLI : %v", err)
 		os.Exit(1)
 	}
@@ -26,17 +44,26 @@ func newApp() *cli.App {
 			{
 				Name:  "build",
 				Usage: "Builds custom binaries for RestQL with the given plugins",
-				Flags: []cli.Flag{
+				Flags: append(append(environmentFlags(), workspaceFlags()...),
 					&cli.StringFlag{
-						Name:  "restql-replacement",
-						Value: "",
-						Usage: "Set the path to the local restQL codebase",
+						Name:  "main-template",
+						Usage: "Set the location of a Go text/template that replaces the generated main.go",
+					},
+					&cli.StringSliceFlag{
+						Name:  "include",
+						Usage: "Copy a file next to the generated main.go, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "var",
+						Usage: "Set a name=value variable available to the main template as .Vars, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "embed-config",
+						Usage: "Embed the restQL YAML config in the binary, used when RESTQL_CONFIG is not set",
 					},
 					&cli.StringSliceFlag{
-						Name:     "with",
-						Aliases:  []string{"w"},
-						Required: true,
-						Usage:    "Specify the Go Module name of the plugin, can optionally set the version and a replace path: github.com/user/plugin[@version][=../replace/path]",
+						Name:  "order",
+						Usage: "Set the order plugins register in restQL by repeating it with their import paths, replacing the order of the manifest",
 					},
 					&cli.StringFlag{
 						Name:    "output",
@@ -44,24 +71,199 @@ func newApp() *cli.App {
 						Value:   "./",
 						Usage:   "Set the location where the final binary will be placed",
 					},
-				},
+					&cli.StringSliceFlag{
+						Name:  "platform",
+						Usage: "Build for each of the given os/arch platforms, placing the binaries inside the output directory: linux/amd64,darwin/arm64",
+					},
+					&cli.StringFlag{
+						Name:  "output-template",
+						Value: "restql-{{.Version}}-{{.OS}}-{{.Arch}}",
+						Usage: "Set the name of the binaries when building for multiple platforms",
+					},
+					&cli.StringFlag{
+						Name:  "image",
+						Value: "",
+						Usage: "Set the location of an OCI image tarball to be assembled with the built binaries",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "Set the reference name of the OCI image, can be repeated: myorg/restql:1.0",
+					},
+					&cli.StringFlag{
+						Name:  "base-layer",
+						Value: "",
+						Usage: "Set the location of a layer tarball to be used as the image base instead of scratch",
+					},
+					&cli.StringFlag{
+						Name:  "ca-certs",
+						Value: "",
+						Usage: "Set the location of the CA certificates bundle added to the image, defaults to the system one",
+					},
+					&cli.StringFlag{
+						Name:  "sbom",
+						Value: "",
+						Usage: "Write a bill of materials next to the binary in the given format: cyclonedx or spdx",
+					},
+					&cli.StringFlag{
+						Name:  "ldflags",
+						Value: "",
+						Usage: "Add flags to the ones given to the Go linker",
+					},
+					&cli.StringSliceFlag{
+						Name:  "build-tags",
+						Usage: "Add build tags to the default ones",
+					},
+					&cli.StringFlag{
+						Name:  "gcflags",
+						Value: "",
+						Usage: "Set flags given to the Go compiler",
+					},
+					&cli.StringFlag{
+						Name:  "buildmode",
+						Value: "",
+						Usage: "Set the Go build mode, like pie",
+					},
+					&cli.BoolFlag{
+						Name:  "trimpath",
+						Value: false,
+						Usage: "Remove file system paths from the binary, this also removes the plugin list read by inspect",
+					},
+					&cli.StringFlag{
+						Name:  "goexperiment",
+						Value: "",
+						Usage: "Set the GOEXPERIMENT used when compiling",
+					},
+					&cli.BoolFlag{
+						Name:  "no-static",
+						Value: false,
+						Usage: "Disable static linking, needed by plugins that depend on CGO",
+					},
+					&cli.BoolFlag{
+						Name:  "explain-deps",
+						Value: false,
+						Usage: "Report the modules selected at a version higher than the one some plugin asked for",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-plugin-validation",
+						Value: false,
+						Usage: "Skip checking that the plugins register in restQL, for registrations the check cannot find",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Value: false,
+						Usage: "Print the generated files, injected environment variables and go commands without running them",
+					},
+				),
 				Action: func(ctx *cli.Context) error {
-					withPlugins := ctx.StringSlice("with")
-					output := ctx.String("output")
-					restqlReplacement := ctx.String("restql-replacement")
+					opts, err := loadBuildOptions(ctx)
+					if err != nil {
+						return err
+					}
+
+					if ctx.IsSet("main-template") {
+						opts.MainTemplate = ctx.String("main-template")
+					}
+
+					opts.Include = append(opts.Include, ctx.StringSlice("include")...)
+
+					if ctx.IsSet("embed-config") {
+						opts.EmbedConfig = ctx.String("embed-config")
+					}
+
+					err = opts.WithVars(ctx.StringSlice("var"))
+					if err != nil {
+						return err
+					}
+
+					if ctx.IsSet("order") {
+						err = opts.OrderPlugins(ctx.StringSlice("order"))
+						if err != nil {
+							return err
+						}
+					}
+
+					if ctx.IsSet("output") || opts.Output == "" {
+						opts.Output = ctx.String("output")
+					}
+
+					if ctx.IsSet("platform") {
+						opts.Platforms = ctx.StringSlice("platform")
+					}
+
+					if ctx.IsSet("output-template") || opts.OutputTemplate == "" {
+						opts.OutputTemplate = ctx.String("output-template")
+					}
+
+					if ctx.IsSet("image") {
+						opts.Image = ctx.String("image")
+					}
+
+					if ctx.IsSet("tag") {
+						opts.Tags = ctx.StringSlice("tag")
+					}
+
+					if ctx.IsSet("base-layer") {
+						opts.BaseLayer = ctx.String("base-layer")
+					}
+
+					if ctx.IsSet("ca-certs") {
+						opts.CACerts = ctx.String("ca-certs")
+					}
+
+					if ctx.IsSet("sbom") {
+						opts.SBOM = ctx.String("sbom")
+					}
+
+					if ctx.IsSet("ldflags") {
+						opts.GoBuild.Ldflags = ctx.String("ldflags")
+					}
+
+					if ctx.IsSet("build-tags") {
+						opts.GoBuild.Tags = ctx.StringSlice("build-tags")
+					}
+
+					if ctx.IsSet("gcflags") {
+						opts.GoBuild.Gcflags = ctx.String("gcflags")
+					}
+
+					if ctx.IsSet("buildmode") {
+						opts.GoBuild.BuildMode = ctx.String("buildmode")
+					}
+
+					if ctx.IsSet("trimpath") {
+						opts.GoBuild.Trimpath = ctx.Bool("trimpath")
+					}
+
+					if ctx.IsSet("goexperiment") {
+						opts.GoBuild.GoExperiment = ctx.String("goexperiment")
+					}
+
+					if ctx.IsSet("no-static") {
+						opts.GoBuild.NoStatic = ctx.Bool("no-static")
+					}
 
-					restqlVersion := ctx.Args().Get(0)
-					if restqlVersion == "" {
-						restqlVersion = defaultRestqlVersion
+					if ctx.IsSet("explain-deps") {
+						opts.ExplainDeps = ctx.Bool("explain-deps")
 					}
 
-					return restql.Build(withPlugins, restqlVersion, restqlReplacement, output)
+					if ctx.IsSet("skip-plugin-validation") {
+						opts.SkipValidation = ctx.Bool("skip-plugin-validation")
+					}
+
+					opts.DryRun = ctx.Bool("dry-run")
+
+					return restql.Build(ctx.Context, opts)
 				},
 			},
 			{
 				Name:  "run",
 				Usage: "Run RestQL with the plugin at working directory",
 				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "restql-module",
+						Value: "",
+						Usage: "Set the module path restQL is built from, like the one of a fork, defaults to github.com/b2wdigital/restQL-golang",
+					},
 					&cli.StringFlag{
 						Name:  "restql-replacement",
 						Value: "",
@@ -84,21 +286,265 @@ func newApp() *cli.App {
 						Value: false,
 						Usage: "Enable Go race detection",
 					},
+					&cli.StringFlag{
+						Name:  "offline",
+						Value: "",
+						Usage: "Resolve every module from the directory filled by the fetch command, without network access",
+					},
+					&cli.BoolFlag{
+						Name:  "watch",
+						Value: false,
+						Usage: "Rebuild and restart RestQL when the plugin, the restQL replacement or the config change",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-plugin-validation",
+						Value: false,
+						Usage: "Skip checking that the plugins register in restQL, for registrations the check cannot find",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Value: false,
+						Usage: "Print the generated files, injected environment variables and go commands without running them",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					opts := restql.RunOptions{
+						RestqlModule:      ctx.String("restql-module"),
+						RestqlReplacement: ctx.String("restql-replacement"),
+						Config:            ctx.String("config"),
+						Plugin:            ctx.String("plugin"),
+						Race:              ctx.Bool("race"),
+						Offline:           ctx.String("offline"),
+						Watch:             ctx.Bool("watch"),
+						SkipValidation:    ctx.Bool("skip-plugin-validation"),
+						DryRun:            ctx.Bool("dry-run"),
+					}
+
+					opts.RestqlVersion = ctx.Args().Get(0)
+					if opts.RestqlVersion == "" {
+						opts.RestqlVersion = defaultRestqlVersion
+					}
+
+					return restql.Run(ctx.Context, opts)
+				},
+			},
+			{
+				Name:      "fetch",
+				Usage:     "Store every module needed to build RestQL with the given plugins, for offline builds",
+				ArgsUsage: "[restql-version]",
+				Flags: append(environmentFlags(),
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "./restql-modules",
+						Usage:   "Set the directory where the modules are stored",
+					},
+				),
+				Action: func(ctx *cli.Context) error {
+					opts, err := loadBuildOptions(ctx)
+					if err != nil {
+						return err
+					}
+
+					return restql.Fetch(ctx.Context, opts, ctx.String("output"))
+				},
+			},
+			{
+				Name:      "deps",
+				Usage:     "Report the modules selected at a version higher than the one some plugin asked for, without building",
+				ArgsUsage: "[restql-version]",
+				Flags:     append(environmentFlags(), workspaceFlags()...),
+				Action: func(ctx *cli.Context) error {
+					opts, err := loadBuildOptions(ctx)
+					if err != nil {
+						return err
+					}
+
+					return restql.Deps(ctx.Context, opts, os.Stdout)
+				},
+			},
+			{
+				Name:      "inspect",
+				Usage:     "Report the restQL version, Go version, build settings and plugins of a restQL binary",
+				ArgsUsage: "path/to/binary",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "text",
+						Usage: "Set the report format: text or json",
+					},
+					&cli.BoolFlag{
+						Name:  "config",
+						Value: false,
+						Usage: "Print only the restQL config embedded in the binary",
+					},
 				},
 				Action: func(ctx *cli.Context) error {
-					restqlReplacement := ctx.String("restql-replacement")
-					config := ctx.String("config")
-					pluginLocation := ctx.String("plugin")
-					race := ctx.Bool("race")
+					binary := ctx.Args().Get(0)
+					if binary == "" {
+						return fmt.Errorf("the binary location must be informed")
+					}
 
-					restqlVersion := ctx.Args().Get(0)
-					if restqlVersion == "" {
-						restqlVersion = defaultRestqlVersion
+					if ctx.Bool("config") {
+						return restql.InspectConfig(binary, os.Stdout)
 					}
 
-					return restql.Run(restqlReplacement, restqlVersion, config, pluginLocation, race)
+					return restql.Inspect(binary, ctx.String("format"), os.Stdout)
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "Manage the build environments cached by previous builds",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "ls",
+						Usage: "List the cached build environments",
+						Action: func(ctx *cli.Context) error {
+							return restql.ListCache(os.Stdout)
+						},
+					},
+					{
+						Name:  "prune",
+						Usage: "Remove the cached build environments",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "older-than",
+								Value: 0,
+								Usage: "Only remove the environments not used for the given duration, like 72h",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return restql.PruneCache(ctx.Duration("older-than"))
+						},
+					},
 				},
 			},
 		},
 	}
 }
+
+// environmentFlags returns the flags of the commands preparing a build environment,
+// which select the manifest, restQL, the plugins and the module graph.
+func environmentFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "file",
+			Aliases: []string{"f"},
+			Value:   "",
+			Usage:   "Set the location of a YAML build manifest, command line flags take precedence over its values",
+		},
+		&cli.StringFlag{
+			Name:  "restql-module",
+			Value: "",
+			Usage: "Set the module path restQL is built from, like the one of a fork, defaults to github.com/b2wdigital/restQL-golang",
+		},
+		&cli.StringFlag{
+			Name:  "restql-replacement",
+			Value: "",
+			Usage: "Set the path to the local restQL codebase",
+		},
+		&cli.StringSliceFlag{
+			Name:    "with",
+			Aliases: []string{"w"},
+			Usage:   "Specify the Go Module name of the plugin, can optionally set the version, the package inside the module and a replace path: github.com/user/plugin[@version][//package][=../replace/path]",
+		},
+		&cli.StringSliceFlag{
+			Name:  "replace",
+			Usage: "Replace a dependency in the go.mod, can be repeated: module[@version]=../local/path or module[@version]=module@version",
+		},
+		&cli.StringSliceFlag{
+			Name:  "require",
+			Usage: "Require a dependency at a minimum version in the go.mod, can be repeated: module@version",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "Exclude a dependency version from the go.mod, can be repeated: module@version",
+		},
+		&cli.StringFlag{
+			Name:  "lock-file",
+			Value: "./restql.lock",
+			Usage: "Set the location of the lock file recording the resolved module graph",
+		},
+		&cli.BoolFlag{
+			Name:  "locked",
+			Value: false,
+			Usage: "Restore the exact module graph from the lock file, failing if it would change",
+		},
+	}
+}
+
+// workspaceFlags returns the flags of the commands preparing a build environment in a workspace that may be cached.
+func workspaceFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "offline",
+			Value: "",
+			Usage: "Resolve every module from the directory filled by the fetch command, without network access",
+		},
+		&cli.BoolFlag{
+			Name:  "no-cache",
+			Value: false,
+			Usage: "Prepare a fresh build environment instead of reusing the cached one",
+		},
+		&cli.BoolFlag{
+			Name:  "keep-workdir",
+			Value: false,
+			Usage: "Keep the directory where restQL is prepared, even when the command succeeds",
+		},
+	}
+}
+
+// loadBuildOptions reads the manifest given with --file, if any, and overrides it with the
+// flags of environmentFlags and workspaceFlags that are set and the restQL version argument.
+func loadBuildOptions(ctx *cli.Context) (restql.BuildOptions, error) {
+	opts := restql.BuildOptions{}
+	if manifest := ctx.String("file"); manifest != "" {
+		m, err := restql.LoadBuildManifest(manifest)
+		if err != nil {
+			return restql.BuildOptions{}, err
+		}
+		opts = m
+	}
+
+	opts.WithPlugins(ctx.StringSlice("with"))
+	opts.Replace = append(opts.Replace, ctx.StringSlice("replace")...)
+	opts.Require = append(opts.Require, ctx.StringSlice("require")...)
+	opts.Exclude = append(opts.Exclude, ctx.StringSlice("exclude")...)
+
+	if ctx.IsSet("restql-module") {
+		opts.RestqlModule = ctx.String("restql-module")
+	}
+
+	if ctx.IsSet("restql-replacement") {
+		opts.RestqlReplacement = ctx.String("restql-replacement")
+	}
+
+	if ctx.IsSet("lock-file") || opts.LockFile == "" {
+		opts.LockFile = ctx.String("lock-file")
+	}
+
+	if ctx.IsSet("locked") {
+		opts.Locked = ctx.Bool("locked")
+	}
+
+	if ctx.IsSet("offline") {
+		opts.Offline = ctx.String("offline")
+	}
+
+	if ctx.IsSet("no-cache") {
+		opts.NoCache = ctx.Bool("no-cache")
+	}
+
+	if ctx.IsSet("keep-workdir") {
+		opts.KeepWorkdir = ctx.Bool("keep-workdir")
+	}
+
+	if restqlVersion := ctx.Args().Get(0); restqlVersion != "" {
+		opts.RestqlVersion = restqlVersion
+	}
+	if opts.RestqlVersion == "" {
+		opts.RestqlVersion = defaultRestqlVersion
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,143 @@
+package restql
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// restqlPort is a port restQL listens to, configured by an environment variable.
+type restqlPort struct {
+	envVar string
+	number int
+}
+
+// pluginAPI is how plugins register themselves in restQL.
+type pluginAPI struct {
+	// packagePath is relative to the restQL module
+	packagePath      string
+	registerFunction string
+	hooks            []string
+}
+
+// versionAdapter describes how the CLI integrates with a line of restQL versions:
+// the entrypoint generated for it, where its version is set, how plugins register
+// themselves, how it is configured when running locally and the oldest Go toolchain able to compile it.
+type versionAdapter struct {
+	name                 string
+	constraint           string
+	mainFileTemplate     string
+	buildVersionVariable string
+	pluginAPI            pluginAPI
+	ports                []restqlPort
+	developmentVars      [][2]string
+	minGoVersion         string
+}
+
+var restqlPorts = []restqlPort{
+	{envVar: "RESTQL_PORT", number: 9000},
+	{envVar: "RESTQL_HEALTH_PORT", number: 9001},
+	{envVar: "RESTQL_DEBUG_PORT", number: 9002},
+}
+
+var restqlPluginAPI = pluginAPI{
+	packagePath:      "pkg/restql",
+	registerFunction: "RegisterPlugin",
+	hooks: []string{
+		"BeforeTransaction", "AfterTransaction",
+		"BeforeQuery", "AfterQuery",
+		"BeforeRequest", "AfterRequest",
+		"FindMappingsForTenant", "FindQuery",
+	},
+}
+
+// versionAdapters are checked in order, the last one is used when the version is not a semantic version.
+// All restQL lines integrate the same way so far, a new adapter is only needed when one of them changes it.
+var versionAdapters = []versionAdapter{
+	{
+		name:                 "v4+",
+		constraint:           ">= 0.0.0-0",
+		mainFileTemplate:     mainFileTemplate,
+		buildVersionVariable: "cmd.build",
+		pluginAPI:            restqlPluginAPI,
+		ports:                restqlPorts,
+		developmentVars:      [][2]string{{"RESTQL_ENV", "development"}},
+		minGoVersion:         "1.16",
+	},
+}
+
+// adapterFor returns the adapter whose constraint the restQL version satisfies.
+// Versions that are not semantic versions, like branches or commits, are assumed to be of the latest line.
+func adapterFor(restqlVersion string) versionAdapter {
+	latest := versionAdapters[len(versionAdapters)-1]
+
+	v, err := semver.NewVersion(restqlVersion)
+	if err != nil {
+		return latest
+	}
+
+	for _, a := range versionAdapters {
+		c, err := semver.NewConstraint(a.constraint)
+		if err != nil {
+			panic(fmt.Sprintf("invalid constraint of restQL %s adapter: %v", a.name, err))
+		}
+		if c.Check(v) {
+			return a
+		}
+	}
+
+	return latest
+}
+
+var goVersionRegexp = regexp.MustCompile(`go(\d+)\.(\d+)`)
+
+// goVersion returns the version of the Go toolchain of the environment, as printed by it
+// and as a semantic version, which is nil when the printed version cannot be understood.
+// The toolchain is asked once, in dry run its version is unknown.
+func (e *environment) goVersion(ctx context.Context) (string, *semver.Version, error) {
+	if !e.toolchainAsked {
+		var out bytes.Buffer
+		cmd := e.NewCommand("go", "env", "GOVERSION")
+		// the workspace may not be initialized yet
+		cmd.Dir = os.TempDir()
+
+		err := e.RunCommand(ctx, cmd, &out)
+		if err != nil {
+			return "", nil, err
+		}
+		e.toolchainVersion = strings.TrimSpace(out.String())
+		e.toolchainAsked = true
+	}
+
+	goVersion := e.toolchainVersion
+	matches := goVersionRegexp.FindStringSubmatch(goVersion)
+	if len(matches) != 3 {
+		return goVersion, nil, nil
+	}
+
+	return goVersion, semver.MustParse(matches[1] + "." + matches[2]), nil
+}
+
+// checkGoVersion fails when the Go toolchain of the environment is older than the one required by the restQL line.
+func (e *environment) checkGoVersion(ctx context.Context) error {
+	goVersion, current, err := e.goVersion(ctx)
+	if err != nil || e.dryRun {
+		return err
+	}
+	if current == nil {
+		logWarn("Unable to determine the version of Go toolchain %q, skipping the check for restQL %s", goVersion, e.adapter.name)
+		return nil
+	}
+
+	required := semver.MustParse(e.adapter.minGoVersion)
+	if current.LessThan(required) {
+		return fmt.Errorf("restQL %s requires Go %s or newer, but the toolchain is %s", e.restqlModuleVersion, e.adapter.minGoVersion, goVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package restql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAdapterFor(t *testing.T) {
+	tests := []struct {
+		restqlVersion string
+		expected      string
+	}{
+		{"v4.1.0", "v4+"},
+		{"v4.0.0-beta.1", "v4+"},
+		{"v5.0.0-rc.1", "v4+"},
+		{"v6.2.0", "v4+"},
+		{"v7.0.1", "v4+"},
+		{"", "v4+"},
+		{"master", "v4+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.restqlVersion, func(t *testing.T) {
+			got := adapterFor(tt.restqlVersion)
+			if got.name != tt.expected {
+				t.Fatalf("got = %s, want = %s", got.name, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckGoVersionInDryRun(t *testing.T) {
+	env := newEnvironment("", nil, "v6.2.0")
+	env.DryRun()
+
+	for i := 0; i < 2; i++ {
+		err := env.checkGoVersion(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	want := []string{"go", "env", "GOVERSION"}
+	if len(env.plannedCommands) != 1 || !reflect.DeepEqual(env.plannedCommands[0].args, want) {
+		t.Fatalf("got = %+v, want = %v", env.plannedCommands, want)
+	}
+}
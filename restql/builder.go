@@ -1,63 +1,574 @@
 package restql
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
-// Build generates a restQL binary using the given restQL version and the listed plugins.
-func Build(pluginsInfo []string, restqlVersion string, restqlReplacement string, output string) error {
-	absOutputFile, err := filepath.Abs(output)
+// Build generates a restQL binary using the restQL version and the plugins listed in the options.
+//
+// When the build fails, its workspace is kept and reported along with the failing command.
+// When the context is done, the running command is stopped and the workspace removed instead.
+func Build(ctx context.Context, opts BuildOptions) (err error) {
+	absOutputFile, err := filepath.Abs(opts.Output)
 	if err != nil {
 		return err
 	}
 
-	plugins := make([]plugin, len(pluginsInfo))
-	for i, pi := range pluginsInfo {
-		plugins[i] = parsePluginInfo(pi)
+	platforms, err := parsePlatforms(opts.Platforms)
+	if err != nil {
+		return err
+	}
+
+	if opts.SBOM != "" {
+		_, err = sbomExtension(opts.SBOM)
+		if err != nil {
+			return err
+		}
+	}
+
+	if info, err := os.Stat(absOutputFile); len(platforms) == 0 && err == nil && info.IsDir() {
+		absOutputFile = filepath.Join(absOutputFile, "restql")
 	}
 
-	tempDir, err := ioutil.TempDir("", "restql-compiling-*")
+	env, absLockFile, err := newBuildEnvironment(ctx, opts)
 	if err != nil {
 		return err
 	}
-	env := newEnvironment(tempDir, plugins, restqlVersion)
-	if restqlReplacement != "" {
-		env.UseRestqlReplacement(restqlReplacement)
+
+	if opts.DryRun {
+		return planBuild(ctx, env, opts, absOutputFile, absLockFile, platforms)
 	}
 
-	err = env.Setup()
+	cache, err := openWorkspace(ctx, env, opts.NoCache)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		cleanErr := env.Clean()
-		if cleanErr != nil {
-			logError("An error occurred when cleaning: %v", cleanErr)
-		}
+		releaseWorkspace(ctx, env, cache, opts.KeepWorkdir, err)
 	}()
 
-	err = runGoBuild(env, restqlVersion, absOutputFile)
+	err = setupWorkspace(ctx, env, cache)
+	if err != nil {
+		return err
+	}
+
+	return runBuildSteps(ctx, env, cache, opts, absOutputFile, absLockFile, platforms)
+}
+
+// runBuildSteps checks the plugins of the prepared environment, compiles it and writes the
+// SBOM, the image and the lock asked for in the options. In dry run, the commands are only planned.
+func runBuildSteps(ctx context.Context, env *environment, cache *cacheEntry, opts BuildOptions, absOutputFile string, absLockFile string, platforms []platform) error {
+	err := verifyCompatibility(ctx, env, os.Stderr)
 	if err != nil {
 		return err
 	}
 
+	err = setupPluginOrder(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	err = validatePlugins(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	if opts.ExplainDeps {
+		err = explainDependencies(ctx, env, os.Stdout)
+		if err != nil {
+			return err
+		}
+	}
+
+	// binaries built from local replacements can change without the cache key changing
+	binaryCache := cache
+	if env.hasLocalReplacement() {
+		binaryCache = nil
+	}
+
+	setupBuildVars(env, opts)
+
+	if len(platforms) == 0 {
+		err = compileBinary(ctx, env, binaryCache, opts.RestqlVersion, absOutputFile)
+	} else {
+		err = runPlatformsGoBuild(ctx, env, binaryCache, opts.RestqlVersion, absOutputFile, opts.OutputTemplate, platforms)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.SBOM != "" {
+		sbomExt, err := sbomExtension(opts.SBOM)
+		if err != nil {
+			return err
+		}
+		sbomFile := absOutputFile + sbomExt
+		if len(platforms) > 0 {
+			sbomFile = filepath.Join(absOutputFile, "restql-"+opts.RestqlVersion+sbomExt)
+		}
+
+		err = writeSBOM(ctx, env, opts.SBOM, sbomFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Image != "" {
+		err = buildImage(ctx, env, opts, absOutputFile, platforms)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !opts.Locked {
+		lock, err := newLockFile(ctx, env)
+		if err != nil || env.dryRun {
+			return err
+		}
+
+		err = writeLockFile(absLockFile, lock)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func runGoBuild(env *environment, restqlVersion string, outputFile string) error {
+// newBuildEnvironment creates the environment described by the build options,
+// with the lock and the plugin version ranges resolved, but not set up yet.
+// It also returns the absolute location of the lock file.
+func newBuildEnvironment(ctx context.Context, opts BuildOptions) (*environment, string, error) {
+	if len(opts.Plugins) == 0 {
+		return nil, "", errors.New("at least one plugin must be informed")
+	}
+	err := checkPluginModules(opts.Plugins)
+	if err != nil {
+		return nil, "", err
+	}
+
+	env := newEnvironment("", orderPlugins(opts.Plugins), opts.RestqlVersion)
+	if opts.RestqlModule != "" {
+		env.UseRestqlModule(opts.RestqlModule)
+	}
+	if opts.RestqlReplacement != "" {
+		env.UseRestqlReplacement(opts.RestqlReplacement)
+	}
+	env.UseGoBuildOptions(opts.GoBuild)
+	env.UseTemplateVars(opts.Vars)
+	if opts.SkipValidation {
+		env.SkipPluginValidation()
+	}
+	if opts.DryRun {
+		env.DryRun()
+	}
+
+	if opts.MainTemplate != "" {
+		err = env.UseMainTemplate(opts.MainTemplate)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	err = env.UseIncludes(opts.Include)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if opts.EmbedConfig != "" {
+		err = env.UseEmbeddedConfig(opts.EmbedConfig)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if opts.Offline != "" {
+		err = env.UseOffline(opts.Offline)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	overrides, err := newDependencyOverrides(opts.Replace, opts.Require, opts.Exclude)
+	if err != nil {
+		return nil, "", err
+	}
+	env.UseDependencyOverrides(overrides)
+
+	absLockFile, lock, err := resolveLockFile(opts, overrides)
+	if err != nil {
+		return nil, "", err
+	}
+	if lock != nil {
+		env.UseLock(lock)
+	}
+
+	err = resolvePluginVersions(ctx, env, lock)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return env, absLockFile, nil
+}
+
+// openWorkspace places the environment in the cache entry of the build or,
+// when the cache is disabled, in a new temporary directory, without setting it up.
+// The returned entry is nil when the cache is not used, otherwise it is locked until the workspace is released.
+func openWorkspace(ctx context.Context, env *environment, noCache bool) (*cacheEntry, error) {
+	cleanErr := cleanAbandonedWorkspaces(os.TempDir(), abandonedWorkspaceAge)
+	if cleanErr != nil {
+		logWarn("An error occurred when removing abandoned workspaces: %v", cleanErr)
+	}
+
+	if !noCache && env.lock == nil {
+		if floating, found := floatingVersion(env); found {
+			logInfo("Not using the cache, since %s is not an exact version and is resolved again on every build", floating)
+			noCache = true
+		}
+	}
+
+	if noCache {
+		dir, err := ioutil.TempDir("", workspacePattern)
+		if err != nil {
+			return nil, err
+		}
+		env.dir = dir
+		return nil, nil
+	}
+
+	key, err := buildCacheKey(ctx, env, env.lock)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := openCacheEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	err = cache.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	env.dir = cache.envDir()
+	return cache, nil
+}
+
+// setupWorkspace prepares the environment, unless its cache entry was already prepared by a previous build.
+func setupWorkspace(ctx context.Context, env *environment, cache *cacheEntry) error {
+	if cache != nil {
+		return setupCachedEnvironment(ctx, env, cache)
+	}
+	return env.Setup(ctx)
+}
+
+// resolveLockFile returns the absolute location of the lock file of the build and,
+// when the build is locked, the lock read from it and verified against the options.
+func resolveLockFile(opts BuildOptions, overrides dependencyOverrides) (string, *lockFile, error) {
+	lockFileLocation := opts.LockFile
+	if lockFileLocation == "" {
+		lockFileLocation = defaultLockFile
+	}
+	absLockFile, err := filepath.Abs(lockFileLocation)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !opts.Locked {
+		return absLockFile, nil, nil
+	}
+
+	lock, err := readLockFile(absLockFile)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = lock.verify(opts.restqlModule(), opts.RestqlVersion, opts.Plugins, overrides)
+	if err != nil {
+		return "", nil, fmt.Errorf("build does not match %s: %v", absLockFile, err)
+	}
+
+	return absLockFile, lock, nil
+}
+
+// planBuild reports what building would do, without running anything.
+func planBuild(ctx context.Context, env *environment, opts BuildOptions, absOutputFile string, absLockFile string, platforms []platform) error {
+	env.DryRun()
+	env.dir = filepath.Join(os.TempDir(), workspacePattern)
+
+	err := env.Setup(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = runBuildSteps(ctx, env, nil, opts, absOutputFile, absLockFile, platforms)
+	if err != nil {
+		return err
+	}
+
+	return env.WritePlan(os.Stdout)
+}
+
+func setupBuildVars(env *environment, opts BuildOptions) {
 	env.SetIfNotPresent("GOOS", "linux")
-	env.SetIfNotPresent("CGO_ENABLED", 0)
-	cmd := env.NewCommand("go", "build",
-		"-o", outputFile,
-		"-ldflags", fmt.Sprintf("-s -w -extldflags -static -X github.com/b2wdigital/restQL-golang/v4/cmd.build=%s", restqlVersion),
-		"-tags", "netgo")
+	if !opts.GoBuild.NoStatic {
+		env.SetIfNotPresent("CGO_ENABLED", 0)
+	}
+}
 
-	err := env.RunCommand(cmd, ioutil.Discard)
+// buildImage packs the Linux binaries produced by the build in an OCI image tarball.
+func buildImage(ctx context.Context, env *environment, opts BuildOptions, absOutput string, platforms []platform) error {
+	absImageFile, err := filepath.Abs(opts.Image)
 	if err != nil {
 		return err
 	}
 
+	spec := imageSpec{Tags: opts.Tags, BaseLayer: opts.BaseLayer, CACerts: opts.CACerts, Ports: env.adapter.ports}
+	if len(spec.Tags) == 0 {
+		spec.Tags = []string{"restql:" + opts.RestqlVersion}
+	}
+
+	if len(platforms) == 0 {
+		p, err := targetPlatform(ctx, env)
+		if err != nil {
+			return err
+		}
+		platforms = []platform{p}
+	}
+	if env.dryRun {
+		return nil
+	}
+
+	for _, p := range platforms {
+		if p.OS != "linux" {
+			logWarn("Skipping platform %s from image, only Linux binaries can be packed", p)
+			continue
+		}
+
+		binaryPath := absOutput
+		if len(opts.Platforms) > 0 {
+			name, err := platformOutputName(opts.OutputTemplate, opts.RestqlVersion, p)
+			if err != nil {
+				return err
+			}
+			binaryPath = filepath.Join(absOutput, name)
+		}
+
+		spec.Binaries = append(spec.Binaries, imageBinary{Platform: p, Path: binaryPath})
+	}
+
+	return writeImage(absImageFile, spec)
+}
+
+// targetPlatform returns the platform the Go toolchain compiles to inside the environment.
+func targetPlatform(ctx context.Context, env *environment) (platform, error) {
+	var out bytes.Buffer
+	cmd := env.NewCommand("go", "env", "GOOS", "GOARCH")
+	err := env.RunCommand(ctx, cmd, &out)
+	if err != nil || env.dryRun {
+		return platform{}, err
+	}
+
+	fields := strings.Fields(out.String())
+	if len(fields) != 2 {
+		return platform{}, fmt.Errorf("unexpected go env output: %s", out.String())
+	}
+
+	return platform{OS: fields[0], Arch: fields[1]}, nil
+}
+
+// runPlatformsGoBuild compiles the prepared environment once for every platform,
+// placing the binaries inside the output directory named after the output template.
+func runPlatformsGoBuild(ctx context.Context, env *environment, cache *cacheEntry, restqlVersion string, outputDir string, outputTemplate string, platforms []platform) error {
+	if !env.dryRun {
+		err := os.MkdirAll(outputDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range platforms {
+		name, err := platformOutputName(outputTemplate, restqlVersion, p)
+		if err != nil {
+			return err
+		}
+
+		logInfo("Building for platform %s", p)
+		env.Set("GOOS", p.OS)
+		env.Set("GOARCH", p.Arch)
+		err = compileBinary(ctx, env, cache, restqlVersion, filepath.Join(outputDir, name))
+		if err != nil {
+			return fmt.Errorf("failed to build for platform %s: %w", p, err)
+		}
+	}
+
 	return nil
 }
+
+// setupCachedEnvironment prepares the environment inside the cache entry, unless a previous build already did it.
+func setupCachedEnvironment(ctx context.Context, env *environment, cache *cacheEntry) error {
+	if cache.Prepared() {
+		logInfo("Reusing cached environment: %s", env.dir)
+		// local replacements can change their requirements without changing the cache key
+		if env.lock == nil && env.hasLocalReplacement() {
+			cmd := env.NewCommand("go", "mod", "tidy")
+			return env.RunCommand(ctx, cmd, ioutil.Discard)
+		}
+		return nil
+	}
+
+	err := env.Clean()
+	if err != nil {
+		return err
+	}
+
+	// an entry that fails to be prepared is kept for inspection, the next build sets it up from scratch
+	err = env.Setup(ctx)
+	if err != nil {
+		return err
+	}
+
+	return cache.MarkPrepared(env)
+}
+
+// hasLocalReplacement reports if restQL, a plugin or a dependency is replaced by a local directory.
+func (e *environment) hasLocalReplacement() bool {
+	if e.restqlReplacement != "" {
+		return true
+	}
+	for _, p := range e.plugins {
+		if p.Replace != "" {
+			return true
+		}
+	}
+	for _, r := range e.overrides.replacements() {
+		if isLocalPath(r[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileBinary builds the environment into the output file,
+// reusing the binary kept in the cache for the same target when there is one.
+func compileBinary(ctx context.Context, env *environment, cache *cacheEntry, restqlVersion string, outputFile string) error {
+	if cache == nil {
+		return runGoBuild(ctx, env, restqlVersion, outputFile)
+	}
+
+	p, err := targetPlatform(ctx, env)
+	if err != nil {
+		return err
+	}
+	args, err := goBuildArgs(env, restqlVersion)
+	if err != nil {
+		return err
+	}
+	buildArgs := strings.Join(args, " ")
+	target := fmt.Sprintf("%s-%s-%.16x", p.OS, p.Arch, sha256.Sum256([]byte(buildArgs)))
+	cachedBinary := cache.binaryPath(target)
+
+	if _, err := os.Stat(cachedBinary); err == nil {
+		logInfo("Reusing cached binary: %s", cachedBinary)
+		return copyFile(cachedBinary, outputFile)
+	}
+
+	err = runGoBuild(ctx, env, restqlVersion, outputFile)
+	if err != nil {
+		return err
+	}
+
+	return cache.storeBinary(outputFile, target)
+}
+
+// goBuildArgs returns the flags given to go build, except for the output.
+//
+// Besides the restQL version, set in the variable of the restQL module given by its adapter,
+// the import path of every plugin is set in the generated main package,
+// so it is recorded in the binary build information and can be found by Inspect.
+// The user options are always appended to the defaults, disabling static linking only drops
+// the defaults that link restQL statically.
+func goBuildArgs(env *environment, restqlVersion string) ([]string, error) {
+	o := env.goBuild
+
+	restqlMod, err := versionedModulePath(env.restqlModulePath, env.restqlModuleVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	ldflags := []string{"-s", "-w"}
+	var tags []string
+	if !o.NoStatic {
+		ldflags = append(ldflags, "-extldflags", "-static")
+		tags = append(tags, "netgo")
+	}
+	ldflags = append(ldflags,
+		"-X", fmt.Sprintf("%s/%s=%s", restqlMod, env.adapter.buildVersionVariable, restqlVersion),
+		"-X", fmt.Sprintf("%s=%s", pluginsVariablePath, strings.Join(pluginImportPaths(env.plugins), ",")))
+	if o.Ldflags != "" {
+		ldflags = append(ldflags, o.Ldflags)
+	}
+	tags = append(tags, o.Tags...)
+
+	args := []string{"-ldflags", strings.Join(ldflags, " ")}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	if o.Gcflags != "" {
+		args = append(args, "-gcflags", o.Gcflags)
+	}
+	if o.BuildMode != "" {
+		args = append(args, "-buildmode="+o.BuildMode)
+	}
+	if o.Trimpath {
+		args = append(args, "-trimpath")
+	}
+	if env.lock != nil {
+		args = append(args, "-mod=readonly")
+	}
+	return append(args, env.orderArgs()...), nil
+}
+
+func runGoBuild(ctx context.Context, env *environment, restqlVersion string, outputFile string) error {
+	buildArgs, err := goBuildArgs(env, restqlVersion)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"build", "-o", outputFile}, buildArgs...)
+	cmd := env.NewCommand("go", args...)
+
+	started := time.Now()
+	err = env.RunCommand(ctx, cmd, ioutil.Discard)
+	if err != nil {
+		if ctx.Err() != nil {
+			removeInterruptedOutput(outputFile, started)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// removeInterruptedOutput removes the output file when it was written after the interrupted
+// go build started, since it may be incomplete. An older binary at the location is kept.
+func removeInterruptedOutput(outputFile string, started time.Time) {
+	info, err := os.Stat(outputFile)
+	if err != nil || info.ModTime().Before(started) {
+		return
+	}
+
+	logWarn("Removing the binary written by the interrupted build: %s", outputFile)
+	err = os.Remove(outputFile)
+	if err != nil {
+		logError("An error occurred when cleaning: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package restql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGoBuildArgs(t *testing.T) {
+	plugins := []plugin{{ModulePath: "github.com/user/plugin-a"}, {ModulePath: "github.com/user/plugin-b"}}
+
+	tests := []struct {
+		name     string
+		options  GoBuildOptions
+		expected []string
+	}{
+		{
+			"when given no options, return the defaults",
+			GoBuildOptions{},
+			[]string{
+				"-ldflags", "-s -w -extldflags -static -X github.com/b2wdigital/restQL-golang/v6/cmd.build=v6.2.0 -X main.restqlPlugins=github.com/user/plugin-a,github.com/user/plugin-b",
+				"-tags", "netgo",
+			},
+		},
+		{
+			"when given custom options, merge them with the defaults",
+			GoBuildOptions{Ldflags: "-X main.env=prod", Tags: []string{"jsoniter"}, Gcflags: "all=-N -l", BuildMode: "pie", Trimpath: true},
+			[]string{
+				"-ldflags", "-s -w -extldflags -static -X github.com/b2wdigital/restQL-golang/v6/cmd.build=v6.2.0 -X main.restqlPlugins=github.com/user/plugin-a,github.com/user/plugin-b -X main.env=prod",
+				"-tags", "netgo,jsoniter",
+				"-gcflags", "all=-N -l",
+				"-buildmode=pie",
+				"-trimpath",
+			},
+		},
+		{
+			"when static linking is disabled, remove the static flags",
+			GoBuildOptions{NoStatic: true},
+			[]string{
+				"-ldflags", "-s -w -X github.com/b2wdigital/restQL-golang/v6/cmd.build=v6.2.0 -X main.restqlPlugins=github.com/user/plugin-a,github.com/user/plugin-b",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newEnvironment("", plugins, "v6.2.0")
+			env.UseGoBuildOptions(tt.options)
+
+			got, err := goBuildArgs(env, "v6.2.0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("got = %#v, want = %#v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGoBuildArgsOfFork(t *testing.T) {
+	env := newEnvironment("", []plugin{{ModulePath: "github.com/user/plugin"}}, "v7.0.1")
+	env.UseRestqlModule("example.com/platform/restql")
+
+	got, err := goBuildArgs(env, "v7.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "-s -w -extldflags -static -X example.com/platform/restql/v7/cmd.build=v7.0.1 -X main.restqlPlugins=github.com/user/plugin"
+	if got[1] != expected {
+		t.Fatalf("got = %s, want = %s", got[1], expected)
+	}
+}
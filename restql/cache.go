@@ -0,0 +1,515 @@
+package restql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+const cacheDirName = "restql-cli"
+
+// cacheKeyVars are the Go environment variables that change how an environment resolves and compiles.
+var cacheKeyVars = []string{"GOVERSION", "GOFLAGS", "GOPROXY", "GOPRIVATE", "GONOSUMDB", "GOEXPERIMENT", "CGO_ENABLED"}
+
+// cacheLockRetryInterval is how often a build waiting for another one using the same cache entry checks it again.
+var cacheLockRetryInterval = 500 * time.Millisecond
+
+// cacheEntry is a build environment prepared once and reused by every build of the same restQL version and plugins.
+type cacheEntry struct {
+	dir  string
+	lock *os.File
+}
+
+type cacheMetadata struct {
+	Key               string    `json:"key"`
+	RestqlVersion     string    `json:"restqlVersion"`
+	RestqlReplacement string    `json:"restqlReplacement,omitempty"`
+	Plugins           []plugin  `json:"plugins"`
+	CreatedAt         time.Time `json:"createdAt"`
+	LastUsedAt        time.Time `json:"lastUsedAt"`
+}
+
+func cacheDir() (string, error) {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userCacheDir, cacheDirName), nil
+}
+
+// buildCacheKey hashes everything that influences the prepared environment.
+func buildCacheKey(ctx context.Context, env *environment, lock *lockFile) (string, error) {
+	cmd := exec.CommandContext(ctx, "go", append([]string{"env"}, cacheKeyVars...)...)
+	cmd.Env = env.GetAll()
+	goEnv, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to execute command %v: %v", cmd.Args, err)
+	}
+
+	restqlReplacement, err := absPathIfPresent(env.restqlReplacement)
+	if err != nil {
+		return "", err
+	}
+
+	plugins := make([]plugin, len(env.plugins))
+	for i, p := range env.plugins {
+		replace, err := absPathIfPresent(p.Replace)
+		if err != nil {
+			return "", err
+		}
+		p.Replace = replace
+		plugins[i] = p
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "restql %s %s %s\n", env.restqlModulePath, env.restqlModuleVersion, restqlReplacement)
+	for _, p := range plugins {
+		fmt.Fprintf(h, "plugin %s %s %s\n", p.importPath(), p.Version, p.Replace)
+	}
+	if env.mainTemplate != "" {
+		fmt.Fprintf(h, "main template %x\n", sha256.Sum256([]byte(env.mainTemplate)))
+	}
+	for _, location := range env.includes {
+		content, err := ioutil.ReadFile(location)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "include %s %x\n", filepath.Base(location), sha256.Sum256(content))
+	}
+	for _, r := range env.overrides.Replace {
+		fmt.Fprintf(h, "replace %s\n", r)
+	}
+	for _, r := range env.overrides.Require {
+		fmt.Fprintf(h, "require %s\n", r)
+	}
+	for _, x := range env.overrides.Exclude {
+		fmt.Fprintf(h, "exclude %s\n", x)
+	}
+	if env.embeddedConfig != nil {
+		fmt.Fprintf(h, "embedded config %x\n", sha256.Sum256(env.embeddedConfig))
+	}
+	varNames := make([]string, 0, len(env.templateVars))
+	for name := range env.templateVars {
+		varNames = append(varNames, name)
+	}
+	sort.Strings(varNames)
+	for _, name := range varNames {
+		fmt.Fprintf(h, "var %s=%s\n", name, env.templateVars[name])
+	}
+	fmt.Fprintf(h, "env %s\n", goEnv)
+	if lock != nil {
+		fmt.Fprintf(h, "lock %s\n%s\n", lock.GoMod, lock.GoSum)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// floatingVersion finds a module of the build whose version is not exact, like a branch or
+// the latest version, which the cache key cannot tell apart from the one resolved before.
+// Modules replaced by a local directory are not resolved, so their version does not matter.
+func floatingVersion(env *environment) (string, bool) {
+	if env.restqlReplacement == "" && !isExactVersion(env.restqlModuleVersion) {
+		return env.restqlModulePath + "@" + env.restqlModuleVersion, true
+	}
+
+	for _, p := range pluginModules(env.plugins) {
+		if p.Replace == "" && !isExactVersion(p.Version) {
+			if p.Version == "" {
+				return p.ModulePath, true
+			}
+			return p.ModulePath + "@" + p.Version, true
+		}
+	}
+
+	return "", false
+}
+
+// isExactVersion reports if the version is a complete semantic version, including pseudo-versions.
+func isExactVersion(version string) bool {
+	version = strings.TrimSuffix(version, "+incompatible")
+	return semver.IsValid(version) && semver.Canonical(version) == version
+}
+
+func absPathIfPresent(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	return filepath.Abs(path)
+}
+
+func openCacheEntry(key string) (*cacheEntry, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{dir: filepath.Join(dir, key)}
+	err = os.MkdirAll(entry.binariesDir(), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (c *cacheEntry) lockFile() string {
+	return filepath.Join(c.dir, "lock")
+}
+
+// Lock makes the build the only one using the entry, waiting for the others to finish,
+// so two builds never set up the same environment at once.
+func (c *cacheEntry) Lock(ctx context.Context) error {
+	f, err := os.OpenFile(c.lockFile(), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	waiting := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to lock the cache entry %s: %v", c.dir, err)
+		}
+		if locked {
+			c.lock = f
+			return nil
+		}
+
+		if !waiting {
+			logInfo("Waiting for another build using the cached environment: %s", c.dir)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return ctx.Err()
+		case <-time.After(cacheLockRetryInterval):
+		}
+	}
+}
+
+// remove deletes the entry, unless a build is using it. The lock file is deleted last,
+// since it cannot be while locked on every platform.
+func (c *cacheEntry) remove(key string) error {
+	f, err := os.OpenFile(c.lockFile(), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	locked, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if !locked {
+		f.Close()
+		logInfo("Skipping cached environment %.12s, it is in use", key)
+		return nil
+	}
+	c.lock = f
+
+	logInfo("Removing cached environment %.12s", key)
+	entries, err := ioutil.ReadDir(c.dir)
+	if err == nil {
+		for _, e := range entries {
+			if e.Name() == filepath.Base(c.lockFile()) {
+				continue
+			}
+			err = os.RemoveAll(filepath.Join(c.dir, e.Name()))
+			if err != nil {
+				break
+			}
+		}
+	}
+	c.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(c.dir)
+}
+
+// Unlock lets other builds use the entry.
+func (c *cacheEntry) Unlock() {
+	if c.lock == nil {
+		return
+	}
+
+	err := unlockFile(c.lock)
+	if err != nil {
+		logError("An error occurred when unlocking the cache entry: %v", err)
+	}
+	c.lock.Close()
+	c.lock = nil
+}
+
+func (c *cacheEntry) envDir() string {
+	return filepath.Join(c.dir, "env")
+}
+
+func (c *cacheEntry) binariesDir() string {
+	return filepath.Join(c.dir, "bin")
+}
+
+func (c *cacheEntry) metadataFile() string {
+	return filepath.Join(c.dir, "metadata.json")
+}
+
+// binaryPath is where the binary compiled for the given target is kept.
+func (c *cacheEntry) binaryPath(target string) string {
+	return filepath.Join(c.binariesDir(), target)
+}
+
+// Prepared reports if the entry environment was completely set up by a previous build.
+func (c *cacheEntry) Prepared() bool {
+	_, err := os.Stat(c.metadataFile())
+	return err == nil
+}
+
+// MarkPrepared records the entry environment as ready to be reused.
+func (c *cacheEntry) MarkPrepared(env *environment) error {
+	now := time.Now()
+	metadata := cacheMetadata{
+		Key:               filepath.Base(c.dir),
+		RestqlVersion:     env.restqlModuleVersion,
+		RestqlReplacement: env.restqlReplacement,
+		Plugins:           env.plugins,
+		CreatedAt:         now,
+		LastUsedAt:        now,
+	}
+	return writeCacheMetadata(c.metadataFile(), metadata)
+}
+
+// Touch updates the last time the entry was used, which is considered when pruning.
+func (c *cacheEntry) Touch() error {
+	metadata, err := readCacheMetadata(c.metadataFile())
+	if err != nil {
+		return err
+	}
+
+	metadata.LastUsedAt = time.Now()
+	return writeCacheMetadata(c.metadataFile(), metadata)
+}
+
+func readCacheMetadata(location string) (cacheMetadata, error) {
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return cacheMetadata{}, err
+	}
+
+	var metadata cacheMetadata
+	err = json.Unmarshal(content, &metadata)
+	if err != nil {
+		return cacheMetadata{}, err
+	}
+	return metadata, nil
+}
+
+func writeCacheMetadata(location string, metadata cacheMetadata) error {
+	content, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(location, content, 0644)
+}
+
+type cachedEnvironment struct {
+	dir      string
+	size     int64
+	metadata cacheMetadata
+}
+
+func listCacheEntries() ([]cachedEnvironment, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cached []cachedEnvironment
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		entryDir := filepath.Join(dir, e.Name())
+		entry := cacheEntry{dir: entryDir}
+		metadata, err := readCacheMetadata(entry.metadataFile())
+		if err != nil {
+			// an entry without metadata was never completely prepared
+			metadata = cacheMetadata{Key: e.Name(), LastUsedAt: e.ModTime()}
+		}
+
+		size, err := dirSize(entryDir)
+		if err != nil {
+			return nil, err
+		}
+
+		cached = append(cached, cachedEnvironment{dir: entryDir, size: size, metadata: metadata})
+	}
+
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].metadata.LastUsedAt.After(cached[j].metadata.LastUsedAt)
+	})
+
+	return cached, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// ListCache writes a table with every cached build environment.
+func ListCache(out io.Writer) error {
+	cached, err := listCacheEntries()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tRESTQL\tPLUGINS\tSIZE\tLAST USED")
+	for _, c := range cached {
+		plugins := make([]string, len(c.metadata.Plugins))
+		for i, p := range c.metadata.Plugins {
+			plugins[i] = p.importPath()
+			if p.Version != "" {
+				plugins[i] += "@" + p.Version
+			}
+		}
+
+		fmt.Fprintf(w, "%.12s\t%s\t%s\t%s\t%s\n",
+			c.metadata.Key,
+			c.metadata.RestqlVersion,
+			strings.Join(plugins, ","),
+			formatSize(c.size),
+			c.metadata.LastUsedAt.Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
+
+// PruneCache removes the cached build environments not used in the given duration.
+// A zero duration removes all of them.
+func PruneCache(olderThan time.Duration) error {
+	cached, err := listCacheEntries()
+	if err != nil {
+		return err
+	}
+
+	threshold := time.Now().Add(-olderThan)
+	for _, c := range cached {
+		if olderThan > 0 && c.metadata.LastUsedAt.After(threshold) {
+			continue
+		}
+
+		entry := &cacheEntry{dir: c.dir}
+		err := entry.remove(c.metadata.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// storeBinary copies the binary to the target path of the entry through a temporary file
+// renamed into place, so a failed or interrupted copy never leaves a partial binary to be reused.
+func (c *cacheEntry) storeBinary(src string, target string) error {
+	tmp, err := ioutil.TempFile(c.binariesDir(), ".storing-*")
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err == nil {
+		err = copyFile(src, tmp.Name())
+	}
+	if err == nil {
+		err = preserveMode(src, tmp.Name())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.binaryPath(target))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+func preserveMode(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dst, info.Mode())
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
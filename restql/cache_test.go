@@ -0,0 +1,157 @@
+package restql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{512, "512B"},
+		{2048, "2.0KiB"},
+		{5 * 1024 * 1024, "5.0MiB"},
+		{3 * 1024 * 1024 * 1024, "3.0GiB"},
+	}
+
+	for _, tt := range tests {
+		got := formatSize(tt.size)
+		if got != tt.expected {
+			t.Fatalf("got = %s, want = %s", got, tt.expected)
+		}
+	}
+}
+
+func TestBuildCacheKey(t *testing.T) {
+	pluginA := []plugin{{ModulePath: "github.com/user/plugin-a", Version: "v1.0.0"}}
+	pluginB := []plugin{{ModulePath: "github.com/user/plugin-b", Version: "v1.0.0"}}
+
+	keyA, err := buildCacheKey(context.Background(), newEnvironment("", pluginA, "v6.2.0"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sameKeyA, err := buildCacheKey(context.Background(), newEnvironment("", pluginA, "v6.2.0"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keyB, err := buildCacheKey(context.Background(), newEnvironment("", pluginB, "v6.2.0"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keyOtherVersion, err := buildCacheKey(context.Background(), newEnvironment("", pluginA, "v6.1.0"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if keyA != sameKeyA {
+		t.Fatalf("same inputs generated different keys: %s and %s", keyA, sameKeyA)
+	}
+	if keyA == keyB || keyA == keyOtherVersion {
+		t.Fatalf("different inputs generated the same key: %s", keyA)
+	}
+}
+
+func TestFloatingVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		restqlVersion string
+		plugins       []plugin
+		expected      string
+		expectedFound bool
+	}{
+		{"when every version is exact, none is found", "v6.2.0", []plugin{{ModulePath: "github.com/user/plugin", Version: "v1.0.0"}}, "", false},
+		{"when a plugin uses a pseudo-version, it is exact", "v6.2.0", []plugin{{ModulePath: "github.com/user/plugin", Version: "v0.0.0-20230102150405-abcdefabcdef"}}, "", false},
+		{"when a plugin has no version, it is found", "v6.2.0", []plugin{{ModulePath: "github.com/user/plugin"}}, "github.com/user/plugin", true},
+		{"when a plugin uses a branch, it is found", "v6.2.0", []plugin{{ModulePath: "github.com/user/plugin", Version: "main"}}, "github.com/user/plugin@main", true},
+		{"when a plugin uses a major version query, it is found", "v6.2.0", []plugin{{ModulePath: "github.com/user/plugin", Version: "v1"}}, "github.com/user/plugin@v1", true},
+		{"when a plugin is replaced by a directory, its version does not matter", "v6.2.0", []plugin{{ModulePath: "github.com/user/plugin", Replace: "../plugin"}}, "", false},
+		{"when restQL uses a branch, it is found", "master", []plugin{{ModulePath: "github.com/user/plugin", Version: "v1.0.0"}}, defaultRestqlModulePath + "@master", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := floatingVersion(newEnvironment("", tt.plugins, tt.restqlVersion))
+			if got != tt.expected || found != tt.expectedFound {
+				t.Fatalf("got = %q %t, want = %q %t", got, found, tt.expected, tt.expectedFound)
+			}
+		})
+	}
+}
+
+func TestCacheEntryStoreBinary(t *testing.T) {
+	entry := &cacheEntry{dir: t.TempDir()}
+	err := os.MkdirAll(entry.binariesDir(), 0700)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	binary := filepath.Join(t.TempDir(), "restql")
+	err = os.WriteFile(binary, []byte("binary"), 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = entry.storeBinary(binary, "linux-amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err := os.Stat(entry.binaryPath("linux-amd64"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("got = %v %v, want = executable cached binary", info, err)
+	}
+
+	err = entry.storeBinary(filepath.Join(t.TempDir(), "missing"), "linux-arm64")
+	if err == nil {
+		t.Fatalf("got = nil, want = error for a missing binary")
+	}
+	files, err := os.ReadDir(entry.binariesDir())
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got = %d files %v, want = only the stored binary", len(files), err)
+	}
+}
+
+func TestCacheEntryLock(t *testing.T) {
+	retryInterval := cacheLockRetryInterval
+	defer func() { cacheLockRetryInterval = retryInterval }()
+	cacheLockRetryInterval = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	first, second := &cacheEntry{dir: dir}, &cacheEntry{dir: dir}
+
+	err := first.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = second.Lock(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got = %v, want = %v while the entry is locked", err, context.DeadlineExceeded)
+	}
+
+	err = (&cacheEntry{dir: dir}).remove("in use")
+	if _, statErr := os.Stat(dir); err != nil || statErr != nil {
+		t.Fatalf("got = %v %v, want = entry in use kept", err, statErr)
+	}
+
+	first.Unlock()
+	err = second.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second.Unlock()
+
+	err = (&cacheEntry{dir: dir}).remove("unused")
+	if _, statErr := os.Stat(dir); err != nil || !os.IsNotExist(statErr) {
+		t.Fatalf("got = %v %v, want = unused entry removed", err, statErr)
+	}
+}
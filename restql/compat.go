@@ -0,0 +1,223 @@
+package restql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const (
+	compatOK        = "ok"
+	compatUpgrade   = "upgrades restQL"
+	compatUnknown   = "no restQL requirement"
+	compatConflict  = "conflict"
+	compatUnchecked = "unchecked"
+)
+
+// pluginCompatibility is how the restQL requirement of a plugin relates to the restQL version being built.
+type pluginCompatibility struct {
+	plugin          string
+	version         string
+	replacement     string
+	requiredModule  string
+	requiredVersion string
+	status          string
+}
+
+// goModFile is the part of a go.mod, as printed by go mod edit -json, needed to check compatibility.
+type goModFile struct {
+	Require []goModRequire
+}
+
+type goModRequire struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// checkCompatibility reads the go.mod of every plugin in the prepared environment and compares
+// the restQL module it requires with the one being built.
+//
+// A plugin requiring another restQL major version is a conflict, since it would register
+// itself in a module that is not the one running. A plugin requiring a newer version of
+// the same major is reported, since minimal version selection raises restQL to it.
+func checkCompatibility(ctx context.Context, env *environment) ([]pluginCompatibility, error) {
+	restqlMod, err := versionedModulePath(env.restqlModulePath, env.restqlModuleVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := env.ListModules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if env.dryRun {
+		return nil, planCompatibility(ctx, env)
+	}
+	byPath := make(map[string]goModule, len(modules))
+	for _, m := range modules {
+		byPath[m.Path] = m
+	}
+
+	var report []pluginCompatibility
+	for _, p := range pluginModules(env.plugins) {
+		pluginMod, err := versionedModulePath(p.ModulePath, p.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		c := pluginCompatibility{plugin: p.ModulePath, status: compatUnchecked}
+		m, found := byPath[pluginMod]
+		if !found {
+			report = append(report, c)
+			continue
+		}
+		c.version = m.Version
+
+		goModLocation := m.GoMod
+		if m.Replace != nil {
+			c.replacement = m.Replace.Path
+			if m.Replace.Version != "" {
+				c.replacement += "@" + m.Replace.Version
+			}
+			if m.Replace.GoMod != "" {
+				goModLocation = m.Replace.GoMod
+			}
+		}
+
+		goMod, err := env.readGoModFile(ctx, goModLocation)
+		if err != nil {
+			return nil, err
+		}
+
+		c.requiredModule, c.requiredVersion = restqlRequirement(goMod, env.restqlModulePath)
+		c.status = compatibilityStatus(restqlMod, env.restqlModuleVersion, c.requiredModule, c.requiredVersion)
+		report = append(report, c)
+	}
+
+	return report, nil
+}
+
+// planCompatibility plans reading the go.mod of every plugin, whose location is only known once the module graph is resolved.
+func planCompatibility(ctx context.Context, env *environment) error {
+	for _, p := range pluginModules(env.plugins) {
+		pluginMod, err := versionedModulePath(p.ModulePath, p.Version)
+		if err != nil {
+			return err
+		}
+
+		_, err = env.readGoModFile(ctx, fmt.Sprintf("<go.mod of %s>", pluginMod))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *environment) readGoModFile(ctx context.Context, location string) (goModFile, error) {
+	var out bytes.Buffer
+	cmd := e.NewCommand("go", "mod", "edit", "-json", location)
+	err := e.RunCommand(ctx, cmd, &out)
+	if err != nil || e.dryRun {
+		return goModFile{}, err
+	}
+
+	var goMod goModFile
+	err = json.Unmarshal(out.Bytes(), &goMod)
+	if err != nil {
+		return goModFile{}, fmt.Errorf("failed to read %s: %v", location, err)
+	}
+	return goMod, nil
+}
+
+// restqlRequirement returns the restQL module and version required by the go.mod, of any major version.
+func restqlRequirement(goMod goModFile, restqlModulePath string) (string, string) {
+	restqlBase := strings.TrimSuffix(restqlModulePath, moduleMajorSuffix(restqlModulePath))
+	for _, r := range goMod.Require {
+		if strings.TrimSuffix(r.Path, moduleMajorSuffix(r.Path)) == restqlBase {
+			return r.Path, r.Version
+		}
+	}
+	return "", ""
+}
+
+func compatibilityStatus(restqlMod string, restqlVersion string, requiredModule string, requiredVersion string) string {
+	if requiredModule == "" {
+		return compatUnknown
+	}
+	if requiredModule != restqlMod {
+		return compatConflict
+	}
+
+	built, err := semver.NewVersion(restqlVersion)
+	if err != nil {
+		return compatOK
+	}
+	required, err := semver.NewVersion(requiredVersion)
+	if err != nil {
+		return compatOK
+	}
+	if required.GreaterThan(built) {
+		return compatUpgrade
+	}
+	return compatOK
+}
+
+// verifyCompatibility prints the compatibility table of the plugins and fails on conflicts.
+func verifyCompatibility(ctx context.Context, env *environment, out io.Writer) error {
+	report, err := checkCompatibility(ctx, env)
+	if err != nil || env.dryRun {
+		return err
+	}
+
+	restqlMod, err := versionedModulePath(env.restqlModulePath, env.restqlModuleVersion)
+	if err != nil {
+		return err
+	}
+
+	err = writeCompatibilityTable(out, restqlMod, env.restqlModuleVersion, report)
+	if err != nil {
+		return err
+	}
+
+	var conflicts []string
+	for _, c := range report {
+		switch c.status {
+		case compatConflict:
+			conflicts = append(conflicts, fmt.Sprintf("%s requires %s", c.plugin, c.requiredModule))
+		case compatUpgrade:
+			logWarn("Plugin %s raises restQL from %s to %s", c.plugin, env.restqlModuleVersion, c.requiredVersion)
+		case compatUnknown:
+			logWarn("Plugin %s does not require restQL, it may not register anything", c.plugin)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("plugins incompatible with %s: %s", restqlMod, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+func writeCompatibilityTable(out io.Writer, restqlMod string, restqlVersion string, report []pluginCompatibility) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Compatibility with %s %s\n", restqlMod, restqlVersion)
+	fmt.Fprintln(w, "PLUGIN\tVERSION\tREPLACED BY\tREQUIRES\tSTATUS")
+	for _, c := range report {
+		replacement := "-"
+		if c.replacement != "" {
+			replacement = c.replacement
+		}
+		requires := "-"
+		if c.requiredModule != "" {
+			requires = c.requiredModule + " " + c.requiredVersion
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.plugin, c.version, replacement, requires, c.status)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,92 @@
+package restql
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCompatibilityStatus(t *testing.T) {
+	restqlMod := "github.com/b2wdigital/restQL-golang/v6"
+
+	tests := []struct {
+		name            string
+		requiredModule  string
+		requiredVersion string
+		expected        string
+	}{
+		{"when the plugin requires an older version, it is compatible", restqlMod, "v6.0.0", compatOK},
+		{"when the plugin requires the same version, it is compatible", restqlMod, "v6.2.0", compatOK},
+		{"when the plugin requires a newer version, restQL is upgraded", restqlMod, "v6.3.1", compatUpgrade},
+		{"when the plugin requires another major version, it conflicts", "github.com/b2wdigital/restQL-golang/v4", "v4.1.0", compatConflict},
+		{"when the plugin does not require restQL, it is unknown", "", "", compatUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compatibilityStatus(restqlMod, "v6.2.0", tt.requiredModule, tt.requiredVersion)
+			if got != tt.expected {
+				t.Fatalf("got = %s, want = %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRestqlRequirement(t *testing.T) {
+	goMod := goModFile{Require: []goModRequire{
+		{Path: "github.com/other/lib", Version: "v1.0.0"},
+		{Path: "github.com/b2wdigital/restQL-golang/v4", Version: "v4.1.0"},
+	}}
+
+	module, version := restqlRequirement(goMod, defaultRestqlModulePath)
+	if module != "github.com/b2wdigital/restQL-golang/v4" || version != "v4.1.0" {
+		t.Fatalf("got = %s %s, want = github.com/b2wdigital/restQL-golang/v4 v4.1.0", module, version)
+	}
+}
+
+func TestCheckCompatibilityReportsUpgrade(t *testing.T) {
+	env := newTestProxyEnvironment(t, "v6.2.0", "v1.0.0")
+	err := env.Setup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report, err := checkCompatibility(context.Background(), env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []pluginCompatibility{{
+		plugin:          "example.com/newplugin",
+		version:         "v1.0.0",
+		requiredModule:  "example.com/restql/v6",
+		requiredVersion: "v6.3.0",
+		status:          compatUpgrade,
+	}}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("got = %+v, want = %+v", report, expected)
+	}
+}
+
+func TestWriteCompatibilityTable(t *testing.T) {
+	report := []pluginCompatibility{
+		{plugin: "github.com/user/plugin-a", version: "v1.0.0", requiredModule: defaultRestqlModulePath + "/v6", requiredVersion: "v6.3.0", status: compatUpgrade},
+		{plugin: "github.com/user/plugin-b", version: "v0.0.0-00010101000000-000000000000", replacement: "/home/dev/plugin-b", status: compatUnknown},
+	}
+
+	var out bytes.Buffer
+	err := writeCompatibilityTable(&out, defaultRestqlModulePath+"/v6", "v6.2.0", report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `Compatibility with github.com/b2wdigital/restQL-golang/v6 v6.2.0
+PLUGIN                    VERSION                             REPLACED BY         REQUIRES                                       STATUS
+github.com/user/plugin-a  v1.0.0                              -                   github.com/b2wdigital/restQL-golang/v6 v6.3.0  upgrades restQL
+github.com/user/plugin-b  v0.0.0-00010101000000-000000000000  /home/dev/plugin-b  -                                              no restQL requirement
+`
+	if out.String() != expected {
+		t.Fatalf("got = %s, want = %s", out.String(), expected)
+	}
+}
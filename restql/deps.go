@@ -0,0 +1,211 @@
+package restql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// moduleGraph is the requirement graph printed by go mod graph, where every node
+// is a module at a version, written as path@version, except for the main module.
+type moduleGraph struct {
+	main  string
+	edges map[string][]string
+}
+
+// dependencyUpgrade is a module selected at a version higher than the one a plugin asked for.
+type dependencyUpgrade struct {
+	path        string
+	requested   string
+	selected    string
+	requestedBy []string
+	selectedBy  []string
+}
+
+// Deps prepares the environment of the build described in the options, without compiling it,
+// and reports the modules upgraded beyond what the plugins asked for.
+func Deps(ctx context.Context, opts BuildOptions, out io.Writer) (err error) {
+	env, _, err := newBuildEnvironment(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	cache, err := openWorkspace(ctx, env, opts.NoCache)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		releaseWorkspace(ctx, env, cache, opts.KeepWorkdir, err)
+	}()
+
+	err = setupWorkspace(ctx, env, cache)
+	if err != nil {
+		return err
+	}
+
+	return explainDependencies(ctx, env, out)
+}
+
+// explainDependencies analyzes the module graph of the prepared environment and writes,
+// grouped by plugin, every module whose selected version is higher than the one the plugin
+// or its dependencies asked for, along with the requirement chains that explain both versions.
+func explainDependencies(ctx context.Context, env *environment, out io.Writer) error {
+	var graphOut bytes.Buffer
+	cmd := env.NewCommand("go", "mod", "graph")
+	err := env.RunCommand(ctx, cmd, &graphOut)
+	if err != nil {
+		return err
+	}
+	graph := parseModuleGraph(graphOut.Bytes())
+
+	modules, err := env.ListModules(ctx)
+	if err != nil || env.dryRun {
+		return err
+	}
+	selected := make(map[string]string, len(modules))
+	for _, m := range modules {
+		if !m.Main {
+			selected[m.Path] = m.Version
+		}
+	}
+
+	for i, p := range pluginModules(env.plugins) {
+		pluginMod, err := versionedModulePath(p.ModulePath, p.Version)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "Plugin %s %s\n", pluginMod, selected[pluginMod])
+
+		upgrades := graph.upgradesOf(pluginMod+"@"+selected[pluginMod], selected)
+		if len(upgrades) == 0 {
+			fmt.Fprintf(out, "  every dependency is selected at the version asked for\n")
+		}
+		for _, u := range upgrades {
+			fmt.Fprintf(out, "  %s %s => %s\n", u.path, u.requested, u.selected)
+			fmt.Fprintf(out, "    requested by: %s\n", strings.Join(u.requestedBy, " -> "))
+			if len(u.selectedBy) > 0 {
+				fmt.Fprintf(out, "    selected by:  %s\n", strings.Join(u.selectedBy, " -> "))
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseModuleGraph(content []byte) moduleGraph {
+	g := moduleGraph{edges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		from, to := fields[0], fields[1]
+		if path, _ := splitModuleNode(to); path == "go" || path == "toolchain" {
+			continue
+		}
+		if g.main == "" && !strings.Contains(from, "@") {
+			g.main = from
+		}
+		g.edges[from] = append(g.edges[from], to)
+	}
+
+	return g
+}
+
+func splitModuleNode(node string) (string, string) {
+	i := strings.LastIndex(node, "@")
+	if i < 0 {
+		return node, ""
+	}
+	return node[:i], node[i+1:]
+}
+
+// paths walks the graph breadth first from the node, returning the shortest chain
+// that reaches every node found and the order in which they were found.
+func (g moduleGraph) paths(from string) (map[string][]string, []string) {
+	chains := map[string][]string{from: {from}}
+	queue := []string{from}
+
+	for i := 0; i < len(queue); i++ {
+		node := queue[i]
+
+		for _, next := range g.edges[node] {
+			if _, visited := chains[next]; visited {
+				continue
+			}
+			chain := append(append([]string{}, chains[node]...), next)
+			chains[next] = chain
+			queue = append(queue, next)
+		}
+	}
+
+	return chains, queue
+}
+
+// upgradesOf finds the modules required from the plugin node at versions lower than the selected ones.
+// When a module is required several times below the plugin, the highest version asked is considered.
+func (g moduleGraph) upgradesOf(pluginNode string, selected map[string]string) []dependencyUpgrade {
+	pluginPath, _ := splitModuleNode(pluginNode)
+	fromPlugin, order := g.paths(pluginNode)
+	fromMain, _ := g.paths(g.main)
+
+	asked := make(map[string]dependencyUpgrade)
+	for _, node := range order {
+		for _, dep := range g.edges[node] {
+			path, version := splitModuleNode(dep)
+			if path == pluginPath {
+				continue
+			}
+
+			current, found := asked[path]
+			if found && !versionLess(current.requested, version) {
+				continue
+			}
+			asked[path] = dependencyUpgrade{
+				path:        path,
+				requested:   version,
+				requestedBy: append(append([]string{}, fromPlugin[node]...), dep),
+			}
+		}
+	}
+
+	var upgrades []dependencyUpgrade
+	for path, u := range asked {
+		if !versionLess(u.requested, selected[path]) {
+			continue
+		}
+		u.selected = selected[path]
+		u.selectedBy = fromMain[path+"@"+u.selected]
+		upgrades = append(upgrades, u)
+	}
+
+	sort.Slice(upgrades, func(i, j int) bool {
+		return upgrades[i].path < upgrades[j].path
+	})
+	return upgrades
+}
+
+func versionLess(a string, b string) bool {
+	va, err := semver.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	vb, err := semver.NewVersion(b)
+	if err != nil {
+		return false
+	}
+	return va.LessThan(vb)
+}
@@ -0,0 +1,53 @@
+package restql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModuleGraphUpgradesOf(t *testing.T) {
+	graph := parseModuleGraph([]byte(`restql go@1.18
+restql github.com/b2wdigital/restQL-golang/v6@v6.2.0
+restql github.com/user/plugin-a@v1.0.0
+restql github.com/user/plugin-b@v1.0.0
+github.com/user/plugin-a@v1.0.0 github.com/b2wdigital/restQL-golang/v6@v6.0.0
+github.com/user/plugin-a@v1.0.0 github.com/other/lib@v1.1.0
+github.com/user/plugin-b@v1.0.0 github.com/other/tool@v1.0.0
+github.com/other/tool@v1.0.0 github.com/other/lib@v1.3.0
+`))
+
+	selected := map[string]string{
+		"github.com/b2wdigital/restQL-golang/v6": "v6.2.0",
+		"github.com/user/plugin-a":               "v1.0.0",
+		"github.com/user/plugin-b":               "v1.0.0",
+		"github.com/other/tool":                  "v1.0.0",
+		"github.com/other/lib":                   "v1.3.0",
+	}
+
+	expected := []dependencyUpgrade{
+		{
+			path:        "github.com/b2wdigital/restQL-golang/v6",
+			requested:   "v6.0.0",
+			selected:    "v6.2.0",
+			requestedBy: []string{"github.com/user/plugin-a@v1.0.0", "github.com/b2wdigital/restQL-golang/v6@v6.0.0"},
+			selectedBy:  []string{"restql", "github.com/b2wdigital/restQL-golang/v6@v6.2.0"},
+		},
+		{
+			path:        "github.com/other/lib",
+			requested:   "v1.1.0",
+			selected:    "v1.3.0",
+			requestedBy: []string{"github.com/user/plugin-a@v1.0.0", "github.com/other/lib@v1.1.0"},
+			selectedBy:  []string{"restql", "github.com/user/plugin-b@v1.0.0", "github.com/other/tool@v1.0.0", "github.com/other/lib@v1.3.0"},
+		},
+	}
+
+	got := graph.upgradesOf("github.com/user/plugin-a@v1.0.0", selected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got = %+v, want = %+v", got, expected)
+	}
+
+	got = graph.upgradesOf("github.com/user/plugin-b@v1.0.0", selected)
+	if len(got) != 0 {
+		t.Fatalf("got = %+v, want = no upgrades", got)
+	}
+}
@@ -1,6 +1,7 @@
 package restql
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -8,18 +9,42 @@ import (
 	"strings"
 )
 
+// RunOptions describes how a restQL instance must be run with the plugin in development.
+type RunOptions struct {
+	RestqlModule      string
+	RestqlReplacement string
+	RestqlVersion     string
+	Config            string
+	Plugin            string
+	Race              bool
+	Offline           string
+	Watch             bool
+	SkipValidation    bool
+	DryRun            bool
+}
+
 // Run spin up a restQL instance using the given plugin.
 //
-// If a `pluginLocation` is not informed than the current directory is assumed.
+// If a `Plugin` location is not informed than the current directory is assumed.
 // It inherit the environment variables and allow to set a custom restQL config and enable race detection.
-// Also, it can use a different restQL source code with the `restqlReplacement`.
-func Run(restqlReplacement string, restqlVersion string, configLocation string, pluginLocation string, race bool) error {
+// Also, it can build restQL from a fork with the `RestqlModule`, use a different restQL source code with the `RestqlReplacement`
+// and resolve the modules from a directory filled by Fetch with `Offline`.
+// In dry run, it only reports what would be done.
+// With `Watch`, restQL is built and restarted whenever the plugin, the restQL replacement or the config change.
+// The plugins are validated before restQL is built, unless `SkipValidation` is set.
+// When the context is done, restQL is stopped and Run returns.
+func Run(ctx context.Context, opts RunOptions) error {
+	pluginLocation := opts.Plugin
+	if pluginLocation == "" {
+		pluginLocation = "./"
+	}
+
 	absPluginLocation, err := filepath.Abs(pluginLocation)
 	if err != nil {
 		return err
 	}
 
-	pluginDirective, err := getPlugin(absPluginLocation)
+	pluginDirective, err := getPlugin(ctx, absPluginLocation)
 	if err != nil {
 		return err
 	}
@@ -30,20 +55,49 @@ func Run(restqlReplacement string, restqlVersion string, configLocation string,
 	}
 	restqlEnvDir := filepath.Join(currentDir, "/.restql-env")
 
-	env := newEnvironment(restqlEnvDir, []plugin{pluginDirective}, restqlVersion)
-	if restqlReplacement != "" {
-		env.UseRestqlReplacement(restqlReplacement)
+	env := newEnvironment(restqlEnvDir, []plugin{pluginDirective}, opts.RestqlVersion)
+	if opts.RestqlModule != "" {
+		env.UseRestqlModule(opts.RestqlModule)
+	}
+	if opts.RestqlReplacement != "" {
+		env.UseRestqlReplacement(opts.RestqlReplacement)
+	}
+	if opts.Offline != "" {
+		err = env.UseOffline(opts.Offline)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.SkipValidation {
+		env.SkipPluginValidation()
+	}
+	if opts.DryRun {
+		env.DryRun()
 	}
 
 	if _, err := os.Stat(restqlEnvDir); os.IsNotExist(err) {
-		err = env.Setup()
+		err = env.Setup(ctx)
 		if err != nil {
+			// a partially prepared environment would be reused by the next run
+			if !opts.DryRun {
+				cleanWorkspace(env)
+			}
 			return err
 		}
+	} else if opts.DryRun {
+		logInfo("Environment already prepared at %s, setup would be skipped", restqlEnvDir)
 	}
 
-	if configLocation != "" {
-		absConfigLocation, err := filepath.Abs(configLocation)
+	// in watch mode, the plugins are validated before every build
+	if !opts.Watch || opts.DryRun {
+		err = validatePlugins(ctx, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Config != "" {
+		absConfigLocation, err := filepath.Abs(opts.Config)
 		if err != nil {
 			return err
 		}
@@ -51,26 +105,58 @@ func Run(restqlReplacement string, restqlVersion string, configLocation string,
 		env.Set("RESTQL_CONFIG", absConfigLocation)
 	}
 
-	env.SetIfNotPresent("RESTQL_PORT", 9000)
-	env.SetIfNotPresent("RESTQL_HEALTH_PORT", 9001)
-	env.SetIfNotPresent("RESTQL_DEBUG_PORT", 9002)
-	env.SetIfNotPresent("RESTQL_ENV", "development")
+	for _, p := range env.adapter.ports {
+		env.SetIfNotPresent(p.envVar, p.number)
+	}
+	for _, v := range env.adapter.developmentVars {
+		env.SetIfNotPresent(v[0], v[1])
+	}
 
-	cmd := env.NewCommand("go", "run", "main.go")
-	if race {
-		cmd.Args = append(cmd.Args, "-race")
+	if opts.Watch && !opts.DryRun {
+		return watchAndRun(ctx, env, watchedLocations(absPluginLocation, opts), opts.Race)
 	}
 
-	err = env.RunCommand(cmd, os.Stdout)
+	if opts.Watch {
+		err = buildDevBinary(ctx, env, opts.Race)
+	} else {
+		cmd := env.NewCommand("go", "run", "main.go")
+		if opts.Race {
+			cmd.Args = append(cmd.Args, "-race")
+		}
+
+		err = env.RunCommand(ctx, cmd, os.Stdout)
+	}
+	if err != nil && ctx.Err() != nil {
+		logInfo("restQL stopped")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
+	if opts.DryRun {
+		return env.WritePlan(os.Stdout)
+	}
+
 	return nil
 }
 
-func getPlugin(pluginLocation string) (plugin, error) {
-	cmd := exec.Command("go", "list", "-m")
+// watchedLocations lists the plugin, the restQL replacement and the config, whose changes restart restQL in watch mode.
+func watchedLocations(absPluginLocation string, opts RunOptions) []string {
+	locations := []string{absPluginLocation}
+	for _, location := range []string{opts.RestqlReplacement, opts.Config} {
+		if location == "" {
+			continue
+		}
+		if absLocation, err := filepath.Abs(location); err == nil {
+			locations = append(locations, absLocation)
+		}
+	}
+	return locations
+}
+
+func getPlugin(ctx context.Context, pluginLocation string) (plugin, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "-m")
 	cmd.Dir = pluginLocation
 	cmd.Stderr = os.Stderr
 	out, err := cmd.Output()
@@ -0,0 +1,135 @@
+package restql
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	embeddedConfigFile       = "restql-embedded.yml"
+	embeddedConfigSourceFile = "restql_embedded_config.go"
+)
+
+// The embedded config is wrapped in YAML comments, so it is still a valid config
+// and inspect can find it among the bytes of the binary.
+const (
+	embeddedConfigBegin = "# restQL-CLI embedded config begin\n"
+	embeddedConfigEnd   = "\n# restQL-CLI embedded config end\n"
+)
+
+const embeddedConfigSource = `// Code generated by restQL CLI. DO NOT EDIT.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//go:embed ` + embeddedConfigFile + `
+var embeddedConfig []byte
+
+// init makes restQL use the embedded config when RESTQL_CONFIG is not set, by writing it
+// to a temporary file named after its content, so every start reuses the same file.
+// restQL does not start without its config, so it exits when the file cannot be written.
+func init() {
+	if os.Getenv("RESTQL_CONFIG") != "" {
+		return
+	}
+
+	location := filepath.Join(os.TempDir(), fmt.Sprintf("restql-embedded-%.16x.yml", sha256.Sum256(embeddedConfig)))
+	err := writeEmbeddedConfig(location)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the embedded config: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Setenv("RESTQL_CONFIG", location)
+}
+
+// writeEmbeddedConfig writes the config to the location, unless it is already there,
+// renaming it into place so a restQL starting at the same time never reads it partially written.
+func writeEmbeddedConfig(location string) error {
+	current, err := os.ReadFile(location)
+	if err == nil && bytes.Equal(current, embeddedConfig) {
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(location), "restql-embedded-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(embeddedConfig)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), location)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+`
+
+// UseEmbeddedConfig makes the environment embed the restQL config at the given location in the binary.
+func (e *environment) UseEmbeddedConfig(location string) error {
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return fmt.Errorf("failed to read the config to embed: %v", err)
+	}
+
+	var config yaml.Node
+	err = yaml.Unmarshal(content, &config)
+	if err != nil {
+		return fmt.Errorf("failed to parse the config to embed %s: %v", location, err)
+	}
+
+	e.embeddedConfig = content
+	return nil
+}
+
+func (e *environment) setupEmbeddedConfig() error {
+	if e.embeddedConfig == nil {
+		return nil
+	}
+
+	logInfo("Embedding config as: %s", embeddedConfigFile)
+	var content bytes.Buffer
+	content.WriteString(embeddedConfigBegin)
+	content.Write(e.embeddedConfig)
+	content.WriteString(embeddedConfigEnd)
+
+	err := e.WriteFile(embeddedConfigFile, content.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return e.WriteFile(embeddedConfigSourceFile, []byte(embeddedConfigSource))
+}
+
+// findEmbeddedConfig looks for a config embedded by the build among the bytes of a binary.
+func findEmbeddedConfig(binary []byte) (string, bool) {
+	begin := bytes.Index(binary, []byte(embeddedConfigBegin))
+	if begin < 0 {
+		return "", false
+	}
+	begin += len(embeddedConfigBegin)
+
+	end := bytes.Index(binary[begin:], []byte(embeddedConfigEnd))
+	if end < 0 {
+		return "", false
+	}
+
+	return string(binary[begin : begin+end]), true
+}
@@ -0,0 +1,90 @@
+package restql
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindEmbeddedConfig(t *testing.T) {
+	config := "http:\n  timeout: 5s\n"
+
+	tests := []struct {
+		name          string
+		binary        string
+		expected      string
+		expectedFound bool
+	}{
+		{"when the config is embedded, it is found among the binary bytes", "\x00ELF\x01" + embeddedConfigBegin + config + embeddedConfigEnd + "\x00rest", config, true},
+		{"when the config has no trailing newline, it is found as it was", "\x00" + embeddedConfigBegin + "a: 1" + embeddedConfigEnd, "a: 1", true},
+		{"when no config is embedded, nothing is found", "\x00ELF\x01\x00rest", "", false},
+		{"when the end of the config is missing, nothing is found", embeddedConfigBegin + config, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := findEmbeddedConfig([]byte(tt.binary))
+			if found != tt.expectedFound || got != tt.expected {
+				t.Fatalf("got = %q %v, want = %q %v", got, found, tt.expected, tt.expectedFound)
+			}
+		})
+	}
+}
+
+func TestEmbeddedConfigSource(t *testing.T) {
+	dir := t.TempDir()
+	config := "mappings: {}\n"
+	files := map[string]string{
+		"go.mod":                 "module restql\n\ngo 1.18\n",
+		"main.go":                "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc main() {\n\tfmt.Print(os.Getenv(\"RESTQL_CONFIG\"))\n}\n",
+		embeddedConfigFile:       config,
+		embeddedConfigSourceFile: embeddedConfigSource,
+	}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, name), content)
+	}
+
+	binary := filepath.Join(dir, "restql")
+	build := exec.Command("go", "build", "-o", binary, ".")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := build.CombinedOutput()
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+
+	tmpDir := t.TempDir()
+	run := func(tmp string) (string, error) {
+		cmd := exec.Command(binary)
+		cmd.Env = append(os.Environ(), "RESTQL_CONFIG=", "TMPDIR="+tmp)
+		out, err := cmd.Output()
+		return string(out), err
+	}
+
+	first, err := run(tmpDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := run(tmpDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second || filepath.Dir(first) != tmpDir {
+		t.Fatalf("got = %s and %s, want = the same file in %s", first, second, tmpDir)
+	}
+
+	content, err := os.ReadFile(first)
+	if err != nil || string(content) != config {
+		t.Fatalf("got = %q %v, want = %q", content, err, config)
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("got = %d files %v, want = a single config file", len(entries), err)
+	}
+
+	_, err = run(filepath.Join(tmpDir, "missing"))
+	if err == nil {
+		t.Fatalf("got = nil, want = exit error when the config cannot be written")
+	}
+}
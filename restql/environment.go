@@ -2,8 +2,9 @@ package restql
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"html/template"
 	"io"
 	"io/ioutil"
 	"os"
@@ -13,8 +14,10 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/Masterminds/semver/v3"
+	"golang.org/x/mod/modfile"
 )
 
 const defaultRestqlModulePath = "github.com/b2wdigital/restQL-golang"
@@ -31,11 +34,17 @@ import (
 	{{- end}}
 )
 
+// restqlPlugins lists the plugins linked in this binary, it is set at build time.
+var restqlPlugins string
+
 func main() {
 	restqlcmd.Start()
 }
 `
 
+// pluginsVariablePath is the linker path of the variable in the main file that lists the plugins.
+const pluginsVariablePath = "main.restqlPlugins"
+
 type environment struct {
 	dir                 string
 	vars                []string
@@ -43,6 +52,24 @@ type environment struct {
 	restqlModuleVersion string
 	restqlReplacement   string
 	plugins             []plugin
+	lock                *lockFile
+	goBuild             GoBuildOptions
+	offlineDir          string
+	adapter             versionAdapter
+	mainTemplate        string
+	includes            []string
+	templateVars        map[string]string
+	embeddedConfig      []byte
+	overrides           dependencyOverrides
+	skipValidation      bool
+	orderModFile        string
+	toolchainVersion    string
+	toolchainAsked      bool
+	injectedVars        []string
+	dryRun              bool
+	plannedFiles        []plannedFile
+	plannedCommands     []plannedCommand
+	plannedVars         map[string]string
 }
 
 func newEnvironment(dir string, plugins []plugin, restqlModuleVersion string) *environment {
@@ -52,6 +79,7 @@ func newEnvironment(dir string, plugins []plugin, restqlModuleVersion string) *e
 		plugins:             plugins,
 		restqlModulePath:    defaultRestqlModulePath,
 		restqlModuleVersion: restqlModuleVersion,
+		adapter:             adapterFor(restqlModuleVersion),
 	}
 }
 
@@ -62,6 +90,7 @@ func (e *environment) Clean() error {
 func (e *environment) Set(key string, value interface{}) {
 	prefix := fmt.Sprintf("%s=", key)
 	newVar := fmt.Sprintf("%s=%v", key, value)
+	e.recordInjectedVar(key)
 
 	for i, v := range e.vars {
 		if strings.HasPrefix(v, prefix) {
@@ -76,7 +105,17 @@ func (e *environment) SetIfNotPresent(key string, value interface{}) {
 	envVar := e.Get(key)
 	if envVar == nil {
 		e.vars = append(e.vars, fmt.Sprintf("%s=%v", key, value))
+		e.recordInjectedVar(key)
+	}
+}
+
+func (e *environment) recordInjectedVar(key string) {
+	for _, k := range e.injectedVars {
+		if k == key {
+			return
+		}
 	}
+	e.injectedVars = append(e.injectedVars, key)
 }
 
 func (e *environment) Get(key string) interface{} {
@@ -94,10 +133,75 @@ func (e *environment) GetAll() []string {
 	return e.vars
 }
 
+// UseRestqlModule makes the environment build restQL from another module path, like the one of a fork.
+func (e *environment) UseRestqlModule(modulePath string) {
+	e.restqlModulePath = modulePath
+}
+
 func (e *environment) UseRestqlReplacement(path string) {
 	e.restqlReplacement = path
 }
 
+// UseLock makes the environment restore the module graph recorded in the lock
+// instead of resolving it again.
+func (e *environment) UseLock(l *lockFile) {
+	e.lock = l
+}
+
+// UseGoBuildOptions sets the extra options used when compiling the environment.
+func (e *environment) UseGoBuildOptions(o GoBuildOptions) {
+	e.goBuild = o
+	if o.GoExperiment != "" {
+		e.Set("GOEXPERIMENT", o.GoExperiment)
+	}
+}
+
+// UseMainTemplate replaces the main file template of the restQL version by the one at the given location.
+func (e *environment) UseMainTemplate(location string) error {
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return fmt.Errorf("failed to read main template: %v", err)
+	}
+	e.mainTemplate = string(content)
+	return nil
+}
+
+// UseIncludes makes the environment copy the files at the given locations next to the main file.
+func (e *environment) UseIncludes(locations []string) error {
+	names := map[string]bool{
+		"main.go": true, "go.mod": true, "go.sum": true,
+		embeddedConfigFile: true, embeddedConfigSourceFile: true,
+	}
+	for _, location := range locations {
+		info, err := os.Stat(location)
+		if err != nil {
+			return fmt.Errorf("failed to include file: %v", err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("failed to include %s: it is a directory", location)
+		}
+
+		name := filepath.Base(location)
+		if names[name] {
+			return fmt.Errorf("failed to include %s: the environment already has a file named %s", location, name)
+		}
+		names[name] = true
+	}
+
+	e.includes = locations
+	return nil
+}
+
+// SkipPluginValidation makes the environment trust the plugins register in restQL without reading their source.
+func (e *environment) SkipPluginValidation() {
+	e.skipValidation = true
+}
+
+// UseTemplateVars sets the values available to the main file template as .Vars.
+func (e *environment) UseTemplateVars(vars map[string]string) {
+	e.templateVars = vars
+}
+
 func (e *environment) NewCommand(command string, args ...string) *exec.Cmd {
 	cmd := exec.Command(command, args...)
 	cmd.Dir = e.dir
@@ -105,160 +209,211 @@ func (e *environment) NewCommand(command string, args ...string) *exec.Cmd {
 	return cmd
 }
 
-func (e *environment) RunCommand(cmd *exec.Cmd, out io.Writer) error {
+// RunCommand runs the command, or plans it in dry run. When the context is done,
+// the command is stopped and the context error returned.
+func (e *environment) RunCommand(ctx context.Context, cmd *exec.Cmd, out io.Writer) error {
+	if e.dryRun {
+		e.planCommand(cmd)
+		return nil
+	}
+
 	logInfo("Executing command: %+v", cmd)
 
+	var stderr bytes.Buffer
 	cmd.Stdout = out
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
 
-	err := cmd.Run()
+	err := runProcess(ctx, cmd)
 	if err != nil {
-		return err
+		cmdErr := &commandError{args: cmd.Args, dir: cmd.Dir, stderr: stderr.String(), err: err}
+		if e.offlineDir != "" && ctx.Err() == nil {
+			return e.offlineError(cmdErr)
+		}
+		return cmdErr
 	}
 
 	return nil
 }
 
-func (e *environment) Setup() error {
-	err := e.initializeDir()
+func (e *environment) Setup(ctx context.Context) error {
+	logInfo("Using restQL %s adapter for version %s", e.adapter.name, e.restqlModuleVersion)
+	err := e.checkGoVersion(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = e.setupMainFile()
+	err = e.initializeDir()
 	if err != nil {
 		return err
 	}
 
-	err = e.setupGoMod()
+	err = e.setupMainFile()
 	if err != nil {
 		return err
 	}
 
-	err = e.setupDependenciesReplacements()
+	err = e.setupIncludedFiles()
 	if err != nil {
 		return err
 	}
 
-	err = e.setupDependenciesVersions()
+	err = e.setupEmbeddedConfig()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func (e *environment) initializeDir() error {
-	if _, err := os.Stat(e.dir); os.IsNotExist(err) {
-		return os.Mkdir(e.dir, 0700)
+	if e.lock != nil {
+		return e.setupFromLock(ctx)
 	}
-	return nil
-}
 
-func (e *environment) setupMainFile() error {
-	mainFileContent, err := parseMainFileTemplate(e)
+	err = e.setupGoMod(ctx)
 	if err != nil {
 		return err
 	}
 
-	mainFilePath := filepath.Join(e.dir, "main.go")
-	logInfo("Writing main file to: %s", mainFilePath)
-	err = ioutil.WriteFile(mainFilePath, mainFileContent, 0644)
+	err = e.setupDependenciesVersions(ctx)
 	if err != nil {
 		return err
 	}
+
 	return nil
 }
 
-func (e *environment) setupGoMod() error {
-	cmd := e.NewCommand("go", "mod", "init", "restql")
-	err := e.RunCommand(cmd, io.Discard)
-	if err != nil {
-		return err
+func (e *environment) initializeDir() error {
+	if e.dryRun {
+		return nil
+	}
+	if _, err := os.Stat(e.dir); os.IsNotExist(err) {
+		return os.Mkdir(e.dir, 0700)
 	}
+	return nil
+}
 
-	cmdTidy := e.NewCommand("go", "mod", "tidy")
-	err = e.RunCommand(cmdTidy, io.Discard)
+func (e *environment) setupMainFile() error {
+	mainFileContent, err := parseMainFileTemplate(e)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	logInfo("Writing main file to: %s", filepath.Join(e.dir, "main.go"))
+	return e.WriteFile("main.go", mainFileContent)
 }
 
-func (e *environment) setupDependenciesReplacements() error {
-	if e.restqlReplacement != "" {
-		absReplacePath, err := filepath.Abs(e.restqlReplacement)
+func (e *environment) setupIncludedFiles() error {
+	for _, location := range e.includes {
+		content, err := ioutil.ReadFile(location)
 		if err != nil {
 			return err
 		}
 
-		restqlMod, err := versionedModulePath(e.restqlModulePath, e.restqlModuleVersion)
+		name := filepath.Base(location)
+		logInfo("Including file %s as: %s", location, filepath.Join(e.dir, name))
+		err = e.WriteFile(name, content)
 		if err != nil {
 			return err
 		}
+	}
 
-		logInfo("Replace dependency %s => %s", restqlMod, e.restqlReplacement)
-		replaceArg := fmt.Sprintf("%s=%s", restqlMod, absReplacePath)
+	return nil
+}
 
-		cmd := e.NewCommand("go", "mod", "edit", "-replace", replaceArg)
-		err = e.RunCommand(cmd, io.Discard)
-		if err != nil {
-			return err
-		}
+// WriteFile creates a file with the given name inside the environment directory.
+func (e *environment) WriteFile(name string, content []byte) error {
+	if e.dryRun {
+		e.plannedFiles = append(e.plannedFiles, plannedFile{name: name, content: content})
+		return nil
 	}
 
-	for _, plugin := range e.plugins {
-		if plugin.Replace == "" {
-			continue
-		}
+	return ioutil.WriteFile(filepath.Join(e.dir, name), content, 0644)
+}
 
-		absReplacePath, err := filepath.Abs(plugin.Replace)
-		if err != nil {
-			return err
-		}
+// setupFromLock restores the go.mod and go.sum recorded in the lock, with the replacements
+// applied again since their paths may differ from the ones of the machine that wrote the lock.
+func (e *environment) setupFromLock(ctx context.Context) error {
+	logInfo("Restoring module graph from lock")
+	f, err := modfile.Parse("go.mod", []byte(e.lock.GoMod), nil)
+	if err != nil {
+		return fmt.Errorf("invalid go.mod in the lock: %v", err)
+	}
 
-		logInfo("Replace dependency %s => %s", plugin.ModulePath, plugin.Replace)
-		replaceArg := fmt.Sprintf("%s=%s", plugin.ModulePath, absReplacePath)
+	err = e.addReplacements(f)
+	if err != nil {
+		return err
+	}
 
-		cmd := e.NewCommand("go", "mod", "edit", "-replace", replaceArg)
-		err = e.RunCommand(cmd, io.Discard)
-		if err != nil {
-			return err
-		}
+	err = e.writeGoMod(f)
+	if err != nil {
+		return err
+	}
+
+	err = e.WriteFile("go.sum", []byte(e.lock.GoSum))
+	if err != nil {
+		return err
+	}
+
+	cmd := e.NewCommand("go", "list", "-mod=readonly", "-m", "all")
+	err = e.RunCommand(ctx, cmd, io.Discard)
+	if err != nil {
+		return fmt.Errorf("locked module graph cannot be restored without changes: %w", err)
 	}
 
 	return nil
 }
 
-func (e *environment) setupDependenciesVersions() error {
+// setupDependenciesVersions resolves the versions of restQL and the plugins not required in the go.mod
+// in a single go get, then lets go mod tidy add what the main file imports from them and select
+// the versions of every module.
+func (e *environment) setupDependenciesVersions(ctx context.Context) error {
 	logInfo("Pinning versions")
-	err := e.execGoGet(e.restqlModulePath, e.restqlModuleVersion)
+	_, queries, err := e.dependencyRequirements()
 	if err != nil {
 		return err
 	}
 
-	for _, plugin := range e.plugins {
-		err := e.execGoGet(plugin.ModulePath, plugin.Version)
+	if len(queries) > 0 {
+		cmd := e.NewCommand("go", append([]string{"get", "-d", "-v"}, queries...)...)
+		err = e.RunCommand(ctx, cmd, io.Discard)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	cmdTidy := e.NewCommand("go", "mod", "tidy")
+	return e.RunCommand(ctx, cmdTidy, io.Discard)
 }
 
-func (e *environment) execGoGet(modulePath, moduleVersion string) error {
-	mod, err := versionedModulePath(modulePath, moduleVersion)
+type goModule struct {
+	Path      string
+	Version   string
+	Replace   *goModule
+	Main      bool
+	Indirect  bool
+	Dir       string
+	GoMod     string
+	GoVersion string
+}
+
+// ListModules returns every module in the build list of the environment.
+func (e *environment) ListModules(ctx context.Context) ([]goModule, error) {
+	var out bytes.Buffer
+	cmd := e.NewCommand("go", "list", "-m", "-json", "all")
+	err := e.RunCommand(ctx, cmd, &out)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if moduleVersion != "" {
-		mod += "@" + moduleVersion
+	var modules []goModule
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var m goModule
+		err := decoder.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
 	}
-	cmd := e.NewCommand("go", "get", "-d", "-v", mod)
-	return e.RunCommand(cmd, io.Discard)
+
+	return modules, nil
 }
 
 // versionedModulePath helps enforce Go Module's Semantic Import Versioning (SIV) by
@@ -302,33 +457,59 @@ func versionedModulePath(modulePath, moduleVersion string) (string, error) {
 
 var moduleVersionRegexp = regexp.MustCompile(`.+/v(\d+)$`)
 
-func parseMainFileTemplate(e *environment) ([]byte, error) {
-	p := make([]string, len(e.plugins))
-	for i, plugin := range e.plugins {
-		p[i] = plugin.ModulePath
+func pluginImportPaths(plugins []plugin) []string {
+	p := make([]string, len(plugins))
+	for i, plugin := range plugins {
+		p[i] = plugin.importPath()
 	}
+	return p
+}
+
+func parseMainFileTemplate(e *environment) ([]byte, error) {
+	p := pluginImportPaths(e.plugins)
 
 	modPath, err := versionedModulePath(e.restqlModulePath, e.restqlModuleVersion)
 	if err != nil {
 		return nil, err
 	}
-	templateContext := mainFileTemplateContext{Plugins: p, RestqlModulePath: modPath}
+	vars := e.templateVars
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	templateContext := mainFileTemplateContext{
+		RestqlModulePath: modPath,
+		RestqlVersion:    e.restqlModuleVersion,
+		Plugins:          p,
+		Vars:             vars,
+	}
+
+	mainTemplate := e.adapter.mainFileTemplate
+	if e.mainTemplate != "" {
+		mainTemplate = e.mainTemplate
+	}
 
-	tpl, err := template.New("main").Parse(mainFileTemplate)
+	tpl, err := template.New("main").Option("missingkey=error").Parse(mainTemplate)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to parse main template: %v", err)
 	}
 
 	var buf bytes.Buffer
 	err = tpl.Execute(&buf, templateContext)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to execute main template: %v", err)
 	}
 
 	return buf.Bytes(), nil
 }
 
+// mainFileTemplateContext is the data given to the main file template.
 type mainFileTemplateContext struct {
+	// RestqlModulePath is the restQL module path, with the major version suffix
 	RestqlModulePath string
-	Plugins          []string
+	// RestqlVersion is the restQL version being built
+	RestqlVersion string
+	// Plugins are the import paths of the plugins, in the order they register
+	Plugins []string
+	// Vars are the values given by the user
+	Vars map[string]string
 }
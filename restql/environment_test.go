@@ -0,0 +1,63 @@
+package restql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMainFileTemplate(t *testing.T) {
+	plugins := []plugin{{ModulePath: "github.com/user/plugin"}, {ModulePath: "github.com/org/plugins", Package: "auth"}}
+
+	tests := []struct {
+		name         string
+		mainTemplate string
+		vars         map[string]string
+		expected     []string
+	}{
+		{
+			"when no template is given, the one of the restQL version imports restQL and the plugins",
+			"",
+			nil,
+			[]string{`restqlcmd "github.com/b2wdigital/restQL-golang/v6/cmd"`, `_ "github.com/user/plugin"`, `_ "github.com/org/plugins/auth"`},
+		},
+		{
+			"when a template is given, it is executed with the context and the code is not escaped",
+			`// {{ .RestqlModulePath }} {{ .RestqlVersion }} {{ range .Plugins }}{{ . }} {{ end }}
+if env := os.Getenv("{{ .Vars.envVar }}"); env == "" && 1 < 2 {}`,
+			map[string]string{"envVar": "RESTQL_TENANT"},
+			[]string{
+				"// github.com/b2wdigital/restQL-golang/v6 v6.2.0 github.com/user/plugin github.com/org/plugins/auth ",
+				`if env := os.Getenv("RESTQL_TENANT"); env == "" && 1 < 2 {}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newEnvironment("", plugins, "v6.2.0")
+			env.mainTemplate = tt.mainTemplate
+			env.UseTemplateVars(tt.vars)
+
+			got, err := parseMainFileTemplate(env)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, e := range tt.expected {
+				if !strings.Contains(string(got), e) {
+					t.Fatalf("got = %s, want = containing %s", got, e)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMainFileTemplateWithUnknownVar(t *testing.T) {
+	env := newEnvironment("", []plugin{{ModulePath: "github.com/user/plugin"}}, "v6.2.0")
+	env.mainTemplate = `{{ .Vars.missing }}`
+
+	_, err := parseMainFileTemplate(env)
+	if err == nil {
+		t.Fatalf("got = nil, want = error for a variable that was not given")
+	}
+}
@@ -0,0 +1,189 @@
+package restql
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+const environmentModulePath = "restql"
+
+// setupGoMod writes the go.mod of the environment with its replacements, requirements and exclusions.
+// restQL and the plugins asking for an exact version are required in it, so minimal version selection
+// can raise restQL when a plugin needs a newer one, the other versions are left to be resolved by go get.
+func (e *environment) setupGoMod(ctx context.Context) error {
+	f := new(modfile.File)
+	err := f.AddModuleStmt(environmentModulePath)
+	if err != nil {
+		return err
+	}
+
+	goDirective, err := e.goDirective(ctx)
+	if err != nil {
+		return err
+	}
+	if goDirective != "" {
+		err = f.AddGoStmt(goDirective)
+		if err != nil {
+			return err
+		}
+	}
+
+	requirements, _, err := e.dependencyRequirements()
+	if err != nil {
+		return err
+	}
+	for _, r := range requirements {
+		f.AddNewRequire(r.Path, r.Version, false)
+	}
+
+	for _, r := range e.overrides.Require {
+		logInfo("Require dependency %s", r)
+		path, version := splitModuleVersion(r)
+		f.AddNewRequire(path, version, false)
+	}
+
+	for _, x := range e.overrides.Exclude {
+		logInfo("Exclude dependency %s", x)
+		path, version := splitModuleVersion(x)
+		err = f.AddExclude(path, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = e.addReplacements(f)
+	if err != nil {
+		return err
+	}
+
+	return e.writeGoMod(f)
+}
+
+// goDirective returns the language version of the Go toolchain of the environment,
+// which is empty when the toolchain version cannot be understood.
+func (e *environment) goDirective(ctx context.Context) (string, error) {
+	_, current, err := e.goVersion(ctx)
+	if err != nil || current == nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d", current.Major(), current.Minor()), nil
+}
+
+func (e *environment) addReplacements(f *modfile.File) error {
+	replaces, err := e.replacements()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range replaces {
+		logInfo("Replace dependency %s => %s", r[0], r[1])
+		oldPath, oldVersion := splitModuleVersion(r[0])
+		newPath, newVersion := splitModuleVersion(r[1])
+
+		err = f.AddReplace(oldPath, oldVersion, newPath, newVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *environment) writeGoMod(f *modfile.File) error {
+	f.Cleanup()
+	content, err := f.Format()
+	if err != nil {
+		return err
+	}
+
+	logInfo("Writing go.mod to: %s", filepath.Join(e.dir, "go.mod"))
+	return e.WriteFile("go.mod", content)
+}
+
+// replacements lists the module path and absolute replacement path pairs of the environment.
+func (e *environment) replacements() ([][2]string, error) {
+	var replaces [][2]string
+
+	if e.restqlReplacement != "" {
+		absReplacePath, err := filepath.Abs(e.restqlReplacement)
+		if err != nil {
+			return nil, err
+		}
+
+		restqlMod, err := versionedModulePath(e.restqlModulePath, e.restqlModuleVersion)
+		if err != nil {
+			return nil, err
+		}
+		replaces = append(replaces, [2]string{restqlMod, absReplacePath})
+	}
+
+	for _, p := range pluginModules(e.plugins) {
+		if p.Replace == "" {
+			continue
+		}
+
+		absReplacePath, err := filepath.Abs(p.Replace)
+		if err != nil {
+			return nil, err
+		}
+		replaces = append(replaces, [2]string{p.ModulePath, absReplacePath})
+	}
+
+	return append(replaces, e.overrides.replacements()...), nil
+}
+
+// dependencyRequirements returns the modules of restQL and the plugins whose versions are exact,
+// to be required in the go.mod, and the go get queries of the ones whose versions must be resolved,
+// like branches or a missing version.
+func (e *environment) dependencyRequirements() ([]module.Version, []string, error) {
+	modules := []plugin{{ModulePath: e.restqlModulePath, Version: e.restqlModuleVersion}}
+	modules = append(modules, pluginModules(e.plugins)...)
+
+	var requirements []module.Version
+	var queries []string
+	for _, m := range modules {
+		if isExactVersion(m.Version) {
+			path, err := versionedModulePath(m.ModulePath, m.Version)
+			if err != nil {
+				return nil, nil, err
+			}
+			requirements = append(requirements, module.Version{Path: path, Version: m.Version})
+			continue
+		}
+
+		query, err := moduleQuery(m.ModulePath, m.Version)
+		if err != nil {
+			return nil, nil, err
+		}
+		queries = append(queries, query)
+	}
+
+	return requirements, queries, nil
+}
+
+// splitModuleVersion splits a module@version, local paths and modules without version have an empty version.
+func splitModuleVersion(module string) (string, string) {
+	if isLocalPath(module) {
+		return module, ""
+	}
+	path, version, _ := strings.Cut(module, "@")
+	return path, version
+}
+
+// moduleQuery writes the module and version as go get expects them.
+func moduleQuery(modulePath string, version string) (string, error) {
+	mod, err := versionedModulePath(modulePath, version)
+	if err != nil {
+		return "", err
+	}
+
+	if version != "" {
+		mod += "@" + version
+	}
+	return mod, nil
+}
@@ -0,0 +1,170 @@
+package restql
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/module"
+)
+
+func TestSetupFromLockReplacesAgain(t *testing.T) {
+	plugins := []plugin{{ModulePath: "github.com/user/plugin-a", Version: "v1.0.0", Replace: "/home/dev/plugin-a"}}
+	env := newEnvironment("/tmp/restql-env", plugins, "v6.2.0")
+	env.UseLock(&lockFile{GoMod: `module restql
+
+go 1.21
+
+require github.com/user/plugin-a v1.0.0
+
+replace github.com/user/plugin-a => /home/ci/plugin-a
+`})
+	env.DryRun()
+
+	err := env.Setup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var goMod string
+	for _, f := range env.plannedFiles {
+		if f.name == "go.mod" {
+			goMod = string(f.content)
+		}
+	}
+
+	if !strings.Contains(goMod, "replace github.com/user/plugin-a => /home/dev/plugin-a\n") || strings.Contains(goMod, "/home/ci/plugin-a") {
+		t.Fatalf("got = %s, want = replacement to /home/dev/plugin-a only", goMod)
+	}
+	if !strings.Contains(goMod, "require github.com/user/plugin-a v1.0.0\n") {
+		t.Fatalf("got = %s, want = locked requirement kept", goMod)
+	}
+}
+
+func TestSplitModuleVersion(t *testing.T) {
+	tests := []struct {
+		module          string
+		expectedPath    string
+		expectedVersion string
+	}{
+		{"github.com/other/lib@v1.2.0", "github.com/other/lib", "v1.2.0"},
+		{"github.com/other/lib", "github.com/other/lib", ""},
+		{"/home/dev/lib@fork", "/home/dev/lib@fork", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			path, version := splitModuleVersion(tt.module)
+			if path != tt.expectedPath || version != tt.expectedVersion {
+				t.Fatalf("got = %s %s, want = %s %s", path, version, tt.expectedPath, tt.expectedVersion)
+			}
+		})
+	}
+}
+
+func TestSetupRaisesRestqlRequiredByPlugin(t *testing.T) {
+	env := newTestProxyEnvironment(t, "v6.2.0", "v1.0.0")
+
+	err := env.Setup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	goMod, err := os.ReadFile(filepath.Join(env.dir, "go.mod"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(goMod), "example.com/restql/v6 v6.3.0") {
+		t.Fatalf("got = %s, want = restQL raised to v6.3.0", goMod)
+	}
+}
+
+// testModule is a module served by the directory written by writeTestProxy.
+type testModule struct {
+	path    string
+	version string
+	files   map[string]string
+}
+
+// newTestProxyEnvironment returns an environment building the restQL at example.com/restql with
+// the plugin example.com/newplugin, resolved from a local proxy where the plugin requires restQL v6.3.0.
+func newTestProxyEnvironment(t *testing.T, restqlVersion string, pluginVersion string) *environment {
+	t.Helper()
+
+	restqlFiles := map[string]string{
+		"go.mod":               "module example.com/restql/v6\n\ngo 1.18\n",
+		"cmd/cmd.go":           "package cmd\n\nvar build string\n\nfunc Start() {}\n",
+		"pkg/restql/restql.go": "package restql\n\ntype PluginInfo struct {\n\tName string\n\tType int\n}\n\nfunc RegisterPlugin(p PluginInfo) {}\n",
+	}
+	proxyDir := writeTestProxy(t, []testModule{
+		{path: "example.com/restql/v6", version: "v6.2.0", files: restqlFiles},
+		{path: "example.com/restql/v6", version: "v6.3.0", files: restqlFiles},
+		{path: "example.com/newplugin", version: "v1.0.0", files: map[string]string{
+			"go.mod":    "module example.com/newplugin\n\ngo 1.18\n\nrequire example.com/restql/v6 v6.3.0\n",
+			"plugin.go": "package newplugin\n\nimport \"example.com/restql/v6/pkg/restql\"\n\nfunc init() {\n\trestql.RegisterPlugin(restql.PluginInfo{Name: \"new\"})\n}\n",
+		}},
+	})
+
+	env := newEnvironment(filepath.Join(t.TempDir(), "env"), []plugin{{ModulePath: "example.com/newplugin", Version: pluginVersion}}, restqlVersion)
+	env.UseRestqlModule("example.com/restql")
+	useTestProxy(t, env, proxyDir)
+	return env
+}
+
+// useTestProxy makes the environment resolve the modules from the proxy directory, into an empty module cache.
+func useTestProxy(t *testing.T, env *environment, proxyDir string) {
+	t.Helper()
+
+	err := env.UseOffline(proxyDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	env.Set("GOMODCACHE", t.TempDir())
+	env.Set("GOFLAGS", "-mod=mod -modcacherw")
+	env.Set("GOWORK", "off")
+}
+
+// writeTestProxy lays out the modules in a directory served like a Go module proxy.
+func writeTestProxy(t *testing.T, modules []testModule) string {
+	t.Helper()
+	proxyDir := t.TempDir()
+
+	for _, m := range modules {
+		escaped, err := module.EscapePath(m.path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		versionsDir := filepath.Join(proxyDir, filepath.FromSlash(escaped), "@v")
+		writeTestFile(t, filepath.Join(versionsDir, m.version+".info"), fmt.Sprintf(`{"Version":%q}`, m.version))
+		writeTestFile(t, filepath.Join(versionsDir, m.version+".mod"), m.files["go.mod"])
+
+		var content bytes.Buffer
+		zw := zip.NewWriter(&content)
+		for name, fileContent := range m.files {
+			w, err := zw.Create(m.path + "@" + m.version + "/" + name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err = w.Write([]byte(fileContent))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		err = zw.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		writeTestFile(t, filepath.Join(versionsDir, m.version+".zip"), content.String())
+	}
+
+	err := writeProxyLists(proxyDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return proxyDir
+}
@@ -0,0 +1,391 @@
+package restql
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	ociLayoutVersion       = "1.0.0"
+	ociIndexMediaType      = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType   = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType     = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType      = "application/vnd.oci.image.layer.v1.tar"
+	ociGzipLayerMediaType  = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociRefNameAnnotation   = "org.opencontainers.image.ref.name"
+	imageBinaryPath        = "restql"
+	imageCACertificatePath = "etc/ssl/certs/ca-certificates.crt"
+)
+
+// caCertificateLocations are the usual places where Linux distributions keep the CA bundle.
+var caCertificateLocations = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// imageSpec describes an OCI image holding restQL binaries built for one or more Linux platforms.
+type imageSpec struct {
+	Tags      []string
+	BaseLayer string
+	CACerts   string
+	Ports     []restqlPort
+	Binaries  []imageBinary
+}
+
+type imageBinary struct {
+	Platform platform
+	Path     string
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociImageConfig struct {
+	Architecture string           `json:"architecture"`
+	OS           string           `json:"os"`
+	Config       ociRuntimeConfig `json:"config"`
+	RootFS       ociRootFS        `json:"rootfs"`
+}
+
+type ociRuntimeConfig struct {
+	Entrypoint   []string            `json:"Entrypoint"`
+	Env          []string            `json:"Env"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// blob is a content addressed file of the image layout.
+type blob struct {
+	mediaType string
+	content   []byte
+}
+
+func (b blob) digest() string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b.content))
+}
+
+func (b blob) descriptor() ociDescriptor {
+	return ociDescriptor{MediaType: b.mediaType, Digest: b.digest(), Size: int64(len(b.content))}
+}
+
+// layer is a blob that will be unpacked in the image file system,
+// its diffID is the digest of the uncompressed content.
+type layer struct {
+	blob
+	diffID string
+}
+
+// writeImage assembles an OCI image layout holding the spec binaries and writes it as a tarball at the given location.
+func writeImage(location string, spec imageSpec) error {
+	if len(spec.Binaries) == 0 {
+		return errors.New("no Linux binary available to assemble the image")
+	}
+
+	var baseLayers []layer
+	if spec.BaseLayer != "" {
+		l, err := readBaseLayer(spec.BaseLayer)
+		if err != nil {
+			return fmt.Errorf("failed to read base layer %s: %v", spec.BaseLayer, err)
+		}
+		baseLayers = append(baseLayers, l)
+	}
+
+	caCerts, err := readCACertificates(spec.CACerts)
+	if err != nil {
+		return err
+	}
+
+	var blobs []blob
+	var manifests []ociDescriptor
+	for _, b := range spec.Binaries {
+		binary, err := ioutil.ReadFile(b.Path)
+		if err != nil {
+			return err
+		}
+
+		appLayer, err := newAppLayer(binary, caCerts)
+		if err != nil {
+			return err
+		}
+		layers := append(append([]layer{}, baseLayers...), appLayer)
+
+		manifestBlobs, err := newImageManifest(b.Platform, layers, spec.Ports)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, manifestBlobs...)
+
+		manifest := manifestBlobs[len(manifestBlobs)-1].descriptor()
+		manifest.Platform = &ociPlatform{Architecture: b.Platform.Arch, OS: b.Platform.OS}
+		manifests = append(manifests, manifest)
+	}
+
+	target := manifests[0]
+	if len(manifests) > 1 {
+		content, err := json.Marshal(ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType, Manifests: manifests})
+		if err != nil {
+			return err
+		}
+		platformsIndex := blob{mediaType: ociIndexMediaType, content: content}
+		blobs = append(blobs, platformsIndex)
+		target = platformsIndex.descriptor()
+	}
+
+	index := ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType}
+	for _, tag := range spec.Tags {
+		d := target
+		d.Annotations = map[string]string{ociRefNameAnnotation: tag}
+		index.Manifests = append(index.Manifests, d)
+	}
+	if len(index.Manifests) == 0 {
+		index.Manifests = append(index.Manifests, target)
+	}
+
+	logInfo("Writing image to: %s", location)
+	return writeImageLayout(location, index, blobs)
+}
+
+func newImageManifest(p platform, layers []layer, ports []restqlPort) ([]blob, error) {
+	config := ociImageConfig{
+		Architecture: p.Arch,
+		OS:           p.OS,
+		Config: ociRuntimeConfig{
+			Entrypoint:   []string{"/" + imageBinaryPath},
+			Env:          []string{},
+			ExposedPorts: make(map[string]struct{}, len(ports)),
+		},
+		RootFS: ociRootFS{Type: "layers"},
+	}
+	for _, port := range ports {
+		config.Config.Env = append(config.Config.Env, fmt.Sprintf("%s=%d", port.envVar, port.number))
+		config.Config.ExposedPorts[fmt.Sprintf("%d/tcp", port.number)] = struct{}{}
+	}
+
+	var blobs []blob
+	manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType}
+	for _, l := range layers {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, l.diffID)
+		manifest.Layers = append(manifest.Layers, l.descriptor())
+		blobs = append(blobs, l.blob)
+	}
+
+	configContent, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	configBlob := blob{mediaType: ociConfigMediaType, content: configContent}
+	manifest.Config = configBlob.descriptor()
+
+	manifestContent, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(blobs, configBlob, blob{mediaType: ociManifestMediaType, content: manifestContent}), nil
+}
+
+// newAppLayer packs the restQL binary and the CA certificates in a gzipped layer, along with
+// a world writable tmp directory, which the scratch base does not have and an embedded config needs.
+// Every entry has a fixed modification time so the same inputs always produce the same digest.
+func newAppLayer(binary []byte, caCerts []byte) (layer, error) {
+	var uncompressed bytes.Buffer
+	tw := tar.NewWriter(&uncompressed)
+
+	err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "tmp/", Mode: 01777, ModTime: time.Unix(0, 0)})
+	if err != nil {
+		return layer{}, err
+	}
+
+	if caCerts != nil {
+		for _, dir := range []string{"etc/", "etc/ssl/", "etc/ssl/certs/"} {
+			err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0755, ModTime: time.Unix(0, 0)})
+			if err != nil {
+				return layer{}, err
+			}
+		}
+
+		err := writeTarFile(tw, imageCACertificatePath, 0644, caCerts)
+		if err != nil {
+			return layer{}, err
+		}
+	}
+
+	err = writeTarFile(tw, imageBinaryPath, 0755, binary)
+	if err != nil {
+		return layer{}, err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return layer{}, err
+	}
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err = gw.Write(uncompressed.Bytes())
+	if err != nil {
+		return layer{}, err
+	}
+	err = gw.Close()
+	if err != nil {
+		return layer{}, err
+	}
+
+	return layer{
+		blob:   blob{mediaType: ociGzipLayerMediaType, content: compressed.Bytes()},
+		diffID: fmt.Sprintf("sha256:%x", sha256.Sum256(uncompressed.Bytes())),
+	}, nil
+}
+
+// readBaseLayer loads a layer tarball, which can be either plain or gzipped.
+func readBaseLayer(location string) (layer, error) {
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return layer{}, err
+	}
+
+	if !bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		b := blob{mediaType: ociLayerMediaType, content: content}
+		return layer{blob: b, diffID: b.digest()}, nil
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return layer{}, err
+	}
+	defer gr.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, gr)
+	if err != nil {
+		return layer{}, err
+	}
+
+	return layer{
+		blob:   blob{mediaType: ociGzipLayerMediaType, content: content},
+		diffID: fmt.Sprintf("sha256:%x", h.Sum(nil)),
+	}, nil
+}
+
+// readCACertificates loads the given CA bundle or, if none is given, the one from the current system.
+// A missing system bundle is not an error, the image is just built without it.
+func readCACertificates(location string) ([]byte, error) {
+	if location != "" {
+		return ioutil.ReadFile(location)
+	}
+
+	for _, l := range caCertificateLocations {
+		content, err := ioutil.ReadFile(l)
+		if err == nil {
+			return content, nil
+		}
+	}
+
+	logWarn("No CA certificates found in the system, the image will not have them")
+	return nil, nil
+}
+
+func writeImageLayout(location string, index ociIndex, blobs []blob) error {
+	f, err := os.Create(location)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+
+	layout, err := json.Marshal(map[string]string{"imageLayoutVersion": ociLayoutVersion})
+	if err != nil {
+		return err
+	}
+	err = writeTarFile(tw, "oci-layout", 0644, layout)
+	if err != nil {
+		return err
+	}
+
+	indexContent, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	err = writeTarFile(tw, "index.json", 0644, indexContent)
+	if err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, b := range blobs {
+		d := b.digest()
+		if written[d] {
+			continue
+		}
+		written[d] = true
+
+		err := writeTarFile(tw, "blobs/sha256/"+d[len("sha256:"):], 0644, b.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, mode int64, content []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     mode,
+		Size:     int64(len(content)),
+		ModTime:  time.Unix(0, 0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(content)
+	return err
+}
@@ -0,0 +1,143 @@
+package restql
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteImage(t *testing.T) {
+	dir := t.TempDir()
+
+	binaryPath := filepath.Join(dir, "restql")
+	err := ioutil.WriteFile(binaryPath, []byte("binary"), 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	caCertsPath := filepath.Join(dir, "ca.crt")
+	err = ioutil.WriteFile(caCertsPath, []byte("certificates"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	imagePath := filepath.Join(dir, "image.tar")
+	spec := imageSpec{
+		Tags:     []string{"myorg/restql:1.0"},
+		CACerts:  caCertsPath,
+		Ports:    restqlPorts,
+		Binaries: []imageBinary{{Platform: platform{OS: "linux", Arch: "amd64"}, Path: binaryPath}},
+	}
+	err = writeImage(imagePath, spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files := readTarFiles(t, imagePath)
+
+	if string(files["oci-layout"]) != `{"imageLayoutVersion":"1.0.0"}` {
+		t.Fatalf("unexpected oci-layout: %s", files["oci-layout"])
+	}
+
+	for name, content := range files {
+		if !strings.HasPrefix(name, "blobs/sha256/") {
+			continue
+		}
+		digest := fmt.Sprintf("%x", sha256.Sum256(content))
+		if name != "blobs/sha256/"+digest {
+			t.Fatalf("blob %s has digest %s", name, digest)
+		}
+	}
+
+	var index ociIndex
+	err = json.Unmarshal(files["index.json"], &index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations[ociRefNameAnnotation] != "myorg/restql:1.0" {
+		t.Fatalf("unexpected index: %+v", index)
+	}
+
+	var manifest ociManifest
+	err = json.Unmarshal(files["blobs/sha256/"+strings.TrimPrefix(index.Manifests[0].Digest, "sha256:")], &manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var config ociImageConfig
+	err = json.Unmarshal(files["blobs/sha256/"+strings.TrimPrefix(manifest.Config.Digest, "sha256:")], &config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.OS != "linux" || config.Architecture != "amd64" || config.Config.Entrypoint[0] != "/restql" {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		t.Fatalf("got %d diff ids for %d layers", len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+}
+
+func TestNewAppLayerHasTmpDirectory(t *testing.T) {
+	l, err := newAppLayer([]byte("binary"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(l.blob.content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			t.Fatalf("got = no tmp directory, want = tmp/ in the layer")
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if header.Name == "tmp/" {
+			if header.Typeflag != tar.TypeDir || header.Mode != 01777 {
+				t.Fatalf("got = type %c mode %o, want = directory with mode 1777", header.Typeflag, header.Mode)
+			}
+			return
+		}
+	}
+}
+
+func readTarFiles(t *testing.T, location string) map[string][]byte {
+	f, err := os.Open(location)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		files[header.Name] = content
+	}
+}
@@ -0,0 +1,308 @@
+package restql
+
+import (
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	inspectText = "text"
+	inspectJSON = "json"
+)
+
+// binaryReport is what can be told about a restQL binary from its embedded build information.
+type binaryReport struct {
+	Binary        string            `json:"binary"`
+	GoVersion     string            `json:"goVersion"`
+	RestqlModule  string            `json:"restqlModule,omitempty"`
+	RestqlVersion string            `json:"restqlVersion,omitempty"`
+	Plugins       []reportedModule  `json:"plugins"`
+	Modules       []reportedModule  `json:"modules"`
+	Settings      map[string]string `json:"settings"`
+	Config        string            `json:"embeddedConfig,omitempty"`
+	Notes         []string          `json:"notes,omitempty"`
+}
+
+type reportedModule struct {
+	Path       string `json:"path"`
+	ImportPath string `json:"importPath,omitempty"`
+	Version    string `json:"version"`
+	Sum        string `json:"sum,omitempty"`
+	Replace    string `json:"replace,omitempty"`
+}
+
+// Inspect reads the build information embedded in a restQL binary and reports
+// the restQL version, the Go version, the build settings and the plugins linked in it.
+func Inspect(binaryLocation string, format string, out io.Writer) error {
+	if format != inspectText && format != inspectJSON {
+		return fmt.Errorf("unknown format %q, expected %s or %s", format, inspectText, inspectJSON)
+	}
+
+	info, err := buildinfo.ReadFile(binaryLocation)
+	if err != nil {
+		return fmt.Errorf("failed to read build information from %s: %v", binaryLocation, err)
+	}
+
+	report := newBinaryReport(binaryLocation, info)
+
+	binary, err := ioutil.ReadFile(binaryLocation)
+	if err != nil {
+		return err
+	}
+	report.Config, _ = findEmbeddedConfig(binary)
+
+	if format == inspectJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	return writeBinaryReport(out, report)
+}
+
+// InspectConfig writes the restQL config embedded in the binary by the build.
+func InspectConfig(binaryLocation string, out io.Writer) error {
+	binary, err := ioutil.ReadFile(binaryLocation)
+	if err != nil {
+		return err
+	}
+
+	config, found := findEmbeddedConfig(binary)
+	if !found {
+		return fmt.Errorf("no config is embedded in %s", binaryLocation)
+	}
+
+	_, err = io.WriteString(out, config)
+	return err
+}
+
+func newBinaryReport(binaryLocation string, info *debug.BuildInfo) binaryReport {
+	report := binaryReport{
+		Binary:    binaryLocation,
+		GoVersion: info.GoVersion,
+		Plugins:   []reportedModule{},
+		Settings:  make(map[string]string, len(info.Settings)),
+	}
+
+	var ldflags string
+	for _, s := range info.Settings {
+		report.Settings[s.Key] = s.Value
+		if s.Key == "-ldflags" {
+			ldflags = s.Value
+		}
+	}
+	linkerVars := parseLinkerVariables(ldflags)
+
+	modules := make([]reportedModule, len(info.Deps))
+	for i, d := range info.Deps {
+		modules[i] = newReportedModule(d)
+
+		if strings.TrimSuffix(d.Path, moduleMajorSuffix(d.Path)) == defaultRestqlModulePath {
+			report.RestqlModule = d.Path
+			report.RestqlVersion = d.Version
+		}
+	}
+	report.Modules = modules
+
+	// the module of the version variable is the restQL one, even when it is a fork
+	for variable, value := range linkerVars {
+		restqlMod, found := trimBuildVersionVariable(variable)
+		if !found {
+			continue
+		}
+
+		report.RestqlVersion = value
+		if m, found := findModuleOfPackage(modules, restqlMod); found {
+			report.RestqlModule = m.Path
+		}
+	}
+
+	pluginsVar, found := linkerVars[pluginsVariablePath]
+	if !found {
+		report.Notes = append(report.Notes, "plugin list not recorded in the binary, it was not built by restQL CLI or was built with -trimpath")
+		return report
+	}
+
+	for _, importPath := range strings.Split(pluginsVar, ",") {
+		if importPath == "" {
+			continue
+		}
+
+		m, found := findModuleOfPackage(modules, importPath)
+		if !found {
+			report.Notes = append(report.Notes, fmt.Sprintf("plugin %s not found among the binary modules", importPath))
+			continue
+		}
+		m.ImportPath = importPath
+		report.Plugins = append(report.Plugins, m)
+	}
+
+	return report
+}
+
+// trimBuildVersionVariable returns the module of the variable if it is the build version variable of any restQL adapter.
+func trimBuildVersionVariable(variable string) (string, bool) {
+	for _, a := range versionAdapters {
+		if strings.HasSuffix(variable, "/"+a.buildVersionVariable) {
+			return strings.TrimSuffix(variable, "/"+a.buildVersionVariable), true
+		}
+	}
+	return "", false
+}
+
+func newReportedModule(m *debug.Module) reportedModule {
+	rm := reportedModule{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		rm.Replace = m.Replace.Path
+		if m.Replace.Version != "" {
+			rm.Replace += "@" + m.Replace.Version
+		}
+		if m.Replace.Sum != "" {
+			rm.Sum = m.Replace.Sum
+		}
+	}
+	return rm
+}
+
+func moduleMajorSuffix(modulePath string) string {
+	matches := moduleVersionRegexp.FindStringSubmatch(modulePath)
+	if len(matches) != 2 {
+		return ""
+	}
+	return "/v" + matches[1]
+}
+
+// findModuleOfPackage returns the module providing the package, which is the one with the longest matching path.
+func findModuleOfPackage(modules []reportedModule, importPath string) (reportedModule, bool) {
+	var found reportedModule
+	for _, m := range modules {
+		if importPath != m.Path && !strings.HasPrefix(importPath, m.Path+"/") {
+			continue
+		}
+		if len(m.Path) > len(found.Path) {
+			found = m
+		}
+	}
+	return found, found.Path != ""
+}
+
+// parseLinkerVariables extracts the values set with -X from the ldflags.
+func parseLinkerVariables(ldflags string) map[string]string {
+	vars := make(map[string]string)
+
+	args := splitQuotedFields(ldflags)
+	for i := 0; i < len(args); i++ {
+		var assignment string
+		switch {
+		case args[i] == "-X" && i+1 < len(args):
+			i++
+			assignment = args[i]
+		case strings.HasPrefix(args[i], "-X="):
+			assignment = strings.TrimPrefix(args[i], "-X=")
+		default:
+			continue
+		}
+
+		eq := strings.Index(assignment, "=")
+		if eq < 0 {
+			continue
+		}
+		vars[assignment[:eq]] = assignment[eq+1:]
+	}
+
+	return vars
+}
+
+// splitQuotedFields splits the string around spaces, keeping together the content inside single or double quotes.
+func splitQuotedFields(s string) []string {
+	var fields []string
+	var current strings.Builder
+	var quote rune
+	inField := false
+
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+
+	return fields
+}
+
+func writeBinaryReport(out io.Writer, report binaryReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Binary:\t%s\n", report.Binary)
+	fmt.Fprintf(w, "Go version:\t%s\n", report.GoVersion)
+	if report.RestqlModule != "" {
+		fmt.Fprintf(w, "restQL:\t%s %s\n", report.RestqlModule, report.RestqlVersion)
+	} else {
+		fmt.Fprintf(w, "restQL:\tnot found\n")
+	}
+
+	fmt.Fprintf(w, "\nPlugins:\n")
+	if len(report.Plugins) == 0 {
+		fmt.Fprintf(w, "  none found\n")
+	}
+	for _, p := range report.Plugins {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", p.ImportPath, describeVersion(p), p.Sum)
+	}
+
+	fmt.Fprintf(w, "\nEmbedded config:\n")
+	if report.Config == "" {
+		fmt.Fprintf(w, "  none\n")
+	} else {
+		fmt.Fprintf(w, "  %d bytes, print it with inspect --config\n", len(report.Config))
+	}
+
+	fmt.Fprintf(w, "\nBuild settings:\n")
+	keys := make([]string, 0, len(report.Settings))
+	for k := range report.Settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s\t%s\n", k, report.Settings[k])
+	}
+
+	if len(report.Notes) > 0 {
+		fmt.Fprintf(w, "\nNotes:\n")
+		for _, n := range report.Notes {
+			fmt.Fprintf(w, "  %s\n", n)
+		}
+	}
+
+	return w.Flush()
+}
+
+func describeVersion(m reportedModule) string {
+	if m.Replace != "" {
+		return fmt.Sprintf("%s => %s", m.Version, m.Replace)
+	}
+	return m.Version
+}
@@ -0,0 +1,90 @@
+package restql
+
+import (
+	"reflect"
+	"runtime/debug"
+	"testing"
+)
+
+func TestParseLinkerVariables(t *testing.T) {
+	ldflags := `-s -w -X github.com/b2wdigital/restQL-golang/v6/cmd.build=v6.2.0 -X=main.restqlPlugins=github.com/user/a,github.com/user/b -X 'main.message=hello world'`
+	expected := map[string]string{
+		"github.com/b2wdigital/restQL-golang/v6/cmd.build": "v6.2.0",
+		"main.restqlPlugins": "github.com/user/a,github.com/user/b",
+		"main.message":       "hello world",
+	}
+
+	got := parseLinkerVariables(ldflags)
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got = %+#v, want = %+#v", got, expected)
+	}
+}
+
+func TestNewBinaryReport(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.18",
+		Deps: []*debug.Module{
+			{Path: "github.com/b2wdigital/restQL-golang/v6", Version: "v6.2.0", Sum: "h1:restql"},
+			{Path: "github.com/user/plugins", Version: "v1.0.0", Sum: "h1:plugins"},
+			{Path: "github.com/user/plugins/auth", Version: "v0.1.0", Replace: &debug.Module{Path: "../auth"}},
+			{Path: "github.com/other/lib", Version: "v1.2.3"},
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "-ldflags", Value: "-s -w -X github.com/b2wdigital/restQL-golang/v6/cmd.build=v6.2.0-custom -X main.restqlPlugins=github.com/user/plugins/cache,github.com/user/plugins/auth/jwt"},
+			{Key: "GOOS", Value: "linux"},
+		},
+	}
+
+	report := newBinaryReport("./restql", info)
+
+	if report.RestqlModule != "github.com/b2wdigital/restQL-golang/v6" || report.RestqlVersion != "v6.2.0-custom" {
+		t.Fatalf("unexpected restQL: %s %s", report.RestqlModule, report.RestqlVersion)
+	}
+
+	expectedPlugins := []reportedModule{
+		{Path: "github.com/user/plugins", ImportPath: "github.com/user/plugins/cache", Version: "v1.0.0", Sum: "h1:plugins"},
+		{Path: "github.com/user/plugins/auth", ImportPath: "github.com/user/plugins/auth/jwt", Version: "v0.1.0", Replace: "../auth"},
+	}
+	if !reflect.DeepEqual(report.Plugins, expectedPlugins) {
+		t.Fatalf("got = %+#v, want = %+#v", report.Plugins, expectedPlugins)
+	}
+
+	if report.Settings["GOOS"] != "linux" {
+		t.Fatalf("unexpected settings: %+v", report.Settings)
+	}
+}
+
+func TestNewBinaryReportOfFork(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.18",
+		Deps: []*debug.Module{
+			{Path: "example.com/platform/restql/v7", Version: "v7.0.1"},
+			{Path: "github.com/user/plugin", Version: "v1.0.0"},
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "-ldflags", Value: "-s -w -X example.com/platform/restql/v7/cmd.build=v7.0.1 -X main.restqlPlugins=github.com/user/plugin"},
+		},
+	}
+
+	report := newBinaryReport("./restql", info)
+
+	if report.RestqlModule != "example.com/platform/restql/v7" || report.RestqlVersion != "v7.0.1" {
+		t.Fatalf("unexpected restQL: %s %s", report.RestqlModule, report.RestqlVersion)
+	}
+}
+
+func TestNewBinaryReportWithoutPluginList(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.18",
+		Deps:      []*debug.Module{{Path: "github.com/b2wdigital/restQL-golang/v4", Version: "v4.1.0"}},
+	}
+
+	report := newBinaryReport("./restql", info)
+
+	if report.RestqlVersion != "v4.1.0" {
+		t.Fatalf("unexpected restQL version: %s", report.RestqlVersion)
+	}
+	if len(report.Plugins) != 0 || len(report.Notes) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
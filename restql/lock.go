@@ -0,0 +1,210 @@
+package restql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const defaultLockFile = "restql.lock"
+
+// lockFile records the fully resolved module graph of a build environment,
+// allowing the exact same set of dependencies to be restored later.
+type lockFile struct {
+	RestqlModule  string         `json:"restqlModule"`
+	RestqlVersion string         `json:"restqlVersion"`
+	Plugins       []lockedModule `json:"plugins"`
+	Modules       []lockedModule `json:"modules"`
+	// Overrides are the replacements, requirements and exclusions given by the user
+	Overrides *dependencyOverrides `json:"overrides,omitempty"`
+	GoMod     string               `json:"goMod"`
+	GoSum     string               `json:"goSum"`
+}
+
+type lockedModule struct {
+	Path     string `json:"path"`
+	Range    string `json:"range,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Replace  string `json:"replace,omitempty"`
+	Sum      string `json:"sum,omitempty"`
+	GoModSum string `json:"goModSum,omitempty"`
+}
+
+func readLockFile(location string) (*lockFile, error) {
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var l lockFile
+	err = json.Unmarshal(content, &l)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %v", location, err)
+	}
+
+	return &l, nil
+}
+
+func writeLockFile(location string, l *lockFile) error {
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+
+	logInfo("Writing lock file to: %s", location)
+	return ioutil.WriteFile(location, content, 0644)
+}
+
+// newLockFile captures the module graph resolved by a prepared environment.
+// In dry run, the module graph is only planned to be listed and no lock is returned.
+func newLockFile(ctx context.Context, e *environment) (*lockFile, error) {
+	modules, err := e.ListModules(ctx)
+	if err != nil || e.dryRun {
+		return nil, err
+	}
+
+	goMod, err := ioutil.ReadFile(filepath.Join(e.dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	goSum, err := ioutil.ReadFile(filepath.Join(e.dir, "go.sum"))
+	if err != nil {
+		return nil, err
+	}
+	sums := parseGoSum(goSum)
+
+	restqlMod, err := versionedModulePath(e.restqlModulePath, e.restqlModuleVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &lockFile{
+		RestqlModule: restqlMod,
+		GoMod:        string(goMod),
+		GoSum:        string(goSum),
+	}
+	if !e.overrides.isEmpty() {
+		overrides := e.overrides
+		l.Overrides = &overrides
+	}
+
+	byPath := make(map[string]goModule, len(modules))
+	for _, m := range modules {
+		if m.Main {
+			continue
+		}
+		byPath[m.Path] = m
+		l.Modules = append(l.Modules, newLockedModule(m, sums))
+	}
+
+	if m, found := byPath[restqlMod]; found {
+		l.RestqlVersion = m.Version
+	}
+
+	for _, p := range pluginModules(e.plugins) {
+		pluginMod, err := versionedModulePath(p.ModulePath, p.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		m, found := byPath[pluginMod]
+		if !found {
+			return nil, fmt.Errorf("plugin %s not found in the resolved module graph", p.ModulePath)
+		}
+
+		lm := newLockedModule(m, sums)
+		lm.Path = p.ModulePath
+		lm.Range = p.Range
+		l.Plugins = append(l.Plugins, lm)
+	}
+
+	return l, nil
+}
+
+func newLockedModule(m goModule, sums map[string]string) lockedModule {
+	lm := lockedModule{
+		Path:     m.Path,
+		Version:  m.Version,
+		Sum:      sums[m.Path+" "+m.Version],
+		GoModSum: sums[m.Path+" "+m.Version+"/go.mod"],
+	}
+	if m.Replace != nil {
+		lm.Replace = m.Replace.Path
+		if m.Replace.Version != "" {
+			lm.Replace += "@" + m.Replace.Version
+		}
+	}
+	return lm
+}
+
+// verify checks that the requested restQL version, plugins and dependency overrides are the ones recorded in the lock.
+func (l *lockFile) verify(restqlModule string, restqlVersion string, plugins []plugin, overrides dependencyOverrides) error {
+	lockedRestql := strings.TrimSuffix(l.RestqlModule, moduleMajorSuffix(l.RestqlModule))
+	requestedRestql := strings.TrimSuffix(restqlModule, moduleMajorSuffix(restqlModule))
+	if l.RestqlModule != "" && lockedRestql != requestedRestql {
+		return fmt.Errorf("restQL module %s differs from the locked module %s", restqlModule, l.RestqlModule)
+	}
+
+	if l.RestqlVersion != "" && l.RestqlVersion != restqlVersion {
+		return fmt.Errorf("restQL version %s differs from the locked version %s", restqlVersion, l.RestqlVersion)
+	}
+
+	var lockedOverrides dependencyOverrides
+	if l.Overrides != nil {
+		lockedOverrides = *l.Overrides
+	}
+	if !overrides.sameAs(lockedOverrides) {
+		return fmt.Errorf("dependency replacements, requirements or exclusions differ from the locked ones")
+	}
+
+	// the lock records the plugin modules, a module with several plugin packages is there once
+	modules := pluginModules(plugins)
+	if len(modules) != len(l.Plugins) {
+		return fmt.Errorf("requested %d plugin modules but the lock has %d", len(modules), len(l.Plugins))
+	}
+
+	for _, p := range modules {
+		locked, found := l.findPlugin(p.ModulePath)
+		if !found {
+			return fmt.Errorf("plugin %s is not present in the lock", p.ModulePath)
+		}
+
+		if p.Version != "" && !versionSatisfies(p.Version, locked.Version) {
+			return fmt.Errorf("plugin %s version %s differs from the locked version %s", p.ModulePath, p.Version, locked.Version)
+		}
+	}
+
+	return nil
+}
+
+func (l *lockFile) findPlugin(modulePath string) (lockedModule, bool) {
+	for _, lp := range l.Plugins {
+		if lp.Path == modulePath {
+			return lp, true
+		}
+	}
+	return lockedModule{}, false
+}
+
+// parseGoSum maps each "module version" and "module version/go.mod" entry of a go.sum file to its hash.
+func parseGoSum(content []byte) map[string]string {
+	sums := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		sums[fields[0]+" "+fields[1]] = fields[2]
+	}
+
+	return sums
+}
@@ -0,0 +1,120 @@
+package restql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGoSum(t *testing.T) {
+	goSum := `github.com/user/plugin v1.0.0 h1:ULPGBGnFcKbh/9vh9DWynOYqPKP2+ES6hc54A/yOwQw=
+github.com/user/plugin v1.0.0/go.mod h1:+J1YDdxIz4a31ABzgoTV4nepKyH0vs3zVBoujypFQGU=
+
+invalid line
+`
+	expected := map[string]string{
+		"github.com/user/plugin v1.0.0":        "h1:ULPGBGnFcKbh/9vh9DWynOYqPKP2+ES6hc54A/yOwQw=",
+		"github.com/user/plugin v1.0.0/go.mod": "h1:+J1YDdxIz4a31ABzgoTV4nepKyH0vs3zVBoujypFQGU=",
+	}
+
+	got := parseGoSum([]byte(goSum))
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got = %+#v, want = %+#v", got, expected)
+	}
+}
+
+func TestLockFileVerify(t *testing.T) {
+	lock := &lockFile{
+		RestqlVersion: "v6.2.0",
+		Plugins: []lockedModule{
+			{Path: "github.com/user/plugin-a", Version: "v1.0.0"},
+			{Path: "github.com/user/plugin-b", Version: "v0.3.0"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		restqlVersion string
+		plugins       []plugin
+		expectError   bool
+	}{
+		{
+			"when the plugins match the lock, return no error",
+			"v6.2.0",
+			[]plugin{{ModulePath: "github.com/user/plugin-a", Version: "v1.0.0"}, {ModulePath: "github.com/user/plugin-b"}},
+			false,
+		},
+		{
+			"when the restQL version differs, return an error",
+			"v6.1.0",
+			[]plugin{{ModulePath: "github.com/user/plugin-a"}, {ModulePath: "github.com/user/plugin-b"}},
+			true,
+		},
+		{
+			"when a plugin version differs, return an error",
+			"v6.2.0",
+			[]plugin{{ModulePath: "github.com/user/plugin-a", Version: "v1.1.0"}, {ModulePath: "github.com/user/plugin-b"}},
+			true,
+		},
+		{
+			"when a plugin is not locked, return an error",
+			"v6.2.0",
+			[]plugin{{ModulePath: "github.com/user/plugin-a"}, {ModulePath: "github.com/user/plugin-c"}},
+			true,
+		},
+		{
+			"when a plugin range is satisfied by the locked version, return no error",
+			"v6.2.0",
+			[]plugin{{ModulePath: "github.com/user/plugin-a", Version: "^1.0"}, {ModulePath: "github.com/user/plugin-b"}},
+			false,
+		},
+		{
+			"when a plugin range is not satisfied by the locked version, return an error",
+			"v6.2.0",
+			[]plugin{{ModulePath: "github.com/user/plugin-a", Version: "~1.1.0"}, {ModulePath: "github.com/user/plugin-b"}},
+			true,
+		},
+		{
+			"when a locked plugin is missing, return an error",
+			"v6.2.0",
+			[]plugin{{ModulePath: "github.com/user/plugin-a"}},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := lock.verify(defaultRestqlModulePath, tt.restqlVersion, tt.plugins, dependencyOverrides{})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("got error = %v, expect error = %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestLockFileVerifyRestqlModule(t *testing.T) {
+	lock := &lockFile{RestqlModule: "github.com/b2wdigital/restQL-golang/v6", RestqlVersion: "v6.2.0"}
+
+	err := lock.verify(defaultRestqlModulePath, "v6.2.0", nil, dependencyOverrides{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = lock.verify("example.com/platform/restql", "v6.2.0", nil, dependencyOverrides{})
+	if err == nil {
+		t.Fatalf("expected error when the restQL module differs from the locked one")
+	}
+}
+
+func TestLockFileVerifyOverrides(t *testing.T) {
+	lock := &lockFile{RestqlVersion: "v6.2.0", Overrides: &dependencyOverrides{Exclude: []string{"github.com/other/bad@v1.3.0"}}}
+
+	err := lock.verify(defaultRestqlModulePath, "v6.2.0", nil, dependencyOverrides{Exclude: []string{"github.com/other/bad@v1.3.0"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = lock.verify(defaultRestqlModulePath, "v6.2.0", nil, dependencyOverrides{})
+	if err == nil {
+		t.Fatalf("expected error when the overrides differ from the locked ones")
+	}
+}
@@ -0,0 +1,200 @@
+package restql
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BuildOptions describes how a custom restQL binary must be built.
+//
+// It can be declared in a YAML manifest file, loaded with LoadBuildManifest,
+// and then have any of its values overridden by command line flags.
+type BuildOptions struct {
+	RestqlVersion     string            `yaml:"restql-version"`
+	RestqlModule      string            `yaml:"restql-module"`
+	RestqlReplacement string            `yaml:"restql-replacement"`
+	Output            string            `yaml:"output"`
+	Plugins           []plugin          `yaml:"plugins"`
+	LockFile          string            `yaml:"lock-file"`
+	Locked            bool              `yaml:"locked"`
+	Platforms         []string          `yaml:"platforms"`
+	OutputTemplate    string            `yaml:"output-template"`
+	Image             string            `yaml:"image"`
+	Tags              []string          `yaml:"tags"`
+	BaseLayer         string            `yaml:"base-layer"`
+	CACerts           string            `yaml:"ca-certs"`
+	NoCache           bool              `yaml:"no-cache"`
+	SBOM              string            `yaml:"sbom"`
+	GoBuild           GoBuildOptions    `yaml:"go-build"`
+	KeepWorkdir       bool              `yaml:"keep-workdir"`
+	ExplainDeps       bool              `yaml:"explain-deps"`
+	SkipValidation    bool              `yaml:"skip-plugin-validation"`
+	Offline           string            `yaml:"offline"`
+	MainTemplate      string            `yaml:"main-template"`
+	Include           []string          `yaml:"include"`
+	Vars              map[string]string `yaml:"vars"`
+	EmbedConfig       string            `yaml:"embed-config"`
+	Replace           []string          `yaml:"replace"`
+	Require           []string          `yaml:"require"`
+	Exclude           []string          `yaml:"exclude"`
+	DryRun            bool              `yaml:"-"`
+}
+
+// GoBuildOptions are extra options given to go build when compiling restQL.
+//
+// They are merged with the defaults instead of replacing them, so user ldflags
+// and tags are added to the ones that statically link restQL and set its version.
+type GoBuildOptions struct {
+	Ldflags      string   `yaml:"ldflags"`
+	Tags         []string `yaml:"tags"`
+	Gcflags      string   `yaml:"gcflags"`
+	BuildMode    string   `yaml:"buildmode"`
+	Trimpath     bool     `yaml:"trimpath"`
+	GoExperiment string   `yaml:"goexperiment"`
+	NoStatic     bool     `yaml:"no-static"`
+}
+
+// LoadBuildManifest reads the YAML build manifest at the given location.
+//
+// Relative paths declared in the manifest, like replacements and the output,
+// are resolved from the directory where the manifest is placed.
+func LoadBuildManifest(manifestLocation string) (BuildOptions, error) {
+	content, err := ioutil.ReadFile(manifestLocation)
+	if err != nil {
+		return BuildOptions{}, err
+	}
+
+	opts, err := parseBuildManifest(content)
+	if err != nil {
+		return BuildOptions{}, fmt.Errorf("invalid build manifest %s: %v", manifestLocation, err)
+	}
+
+	absManifestLocation, err := filepath.Abs(manifestLocation)
+	if err != nil {
+		return BuildOptions{}, err
+	}
+	opts.resolvePathsFrom(filepath.Dir(absManifestLocation))
+
+	return opts, nil
+}
+
+func parseBuildManifest(content []byte) (BuildOptions, error) {
+	var opts BuildOptions
+	err := yaml.Unmarshal(content, &opts)
+	if err != nil {
+		return BuildOptions{}, err
+	}
+
+	for i, p := range opts.Plugins {
+		if p.ModulePath == "" {
+			return BuildOptions{}, fmt.Errorf("plugin at position %d has no module", i)
+		}
+	}
+
+	return opts, nil
+}
+
+func (o *BuildOptions) resolvePathsFrom(baseDir string) {
+	o.RestqlReplacement = resolvePath(baseDir, o.RestqlReplacement)
+	o.Output = resolvePath(baseDir, o.Output)
+	o.LockFile = resolvePath(baseDir, o.LockFile)
+	o.Image = resolvePath(baseDir, o.Image)
+	o.BaseLayer = resolvePath(baseDir, o.BaseLayer)
+	o.CACerts = resolvePath(baseDir, o.CACerts)
+	o.Offline = resolvePath(baseDir, o.Offline)
+	o.MainTemplate = resolvePath(baseDir, o.MainTemplate)
+	o.EmbedConfig = resolvePath(baseDir, o.EmbedConfig)
+	for i, r := range o.Replace {
+		old, replacement, found := strings.Cut(r, "=")
+		if found && isLocalPath(replacement) {
+			o.Replace[i] = old + "=" + resolvePath(baseDir, replacement)
+		}
+	}
+	for i := range o.Include {
+		o.Include[i] = resolvePath(baseDir, o.Include[i])
+	}
+	for i := range o.Plugins {
+		o.Plugins[i].Replace = resolvePath(baseDir, o.Plugins[i].Replace)
+	}
+}
+
+func resolvePath(baseDir string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// restqlModule returns the module path restQL is built from.
+func (o BuildOptions) restqlModule() string {
+	if o.RestqlModule == "" {
+		return defaultRestqlModulePath
+	}
+	return o.RestqlModule
+}
+
+// WithPlugins adds the plugins described in the `--with` format to the build.
+//
+// A plugin with the same import path of one already present replaces it,
+// allowing command line flags to override what a manifest declares, except for its order.
+func (o *BuildOptions) WithPlugins(pluginsInfo []string) {
+	for _, pi := range pluginsInfo {
+		p := parsePluginInfo(pi)
+		o.addPlugin(p)
+	}
+}
+
+func (o *BuildOptions) addPlugin(p plugin) {
+	for i, current := range o.Plugins {
+		if current.importPath() == p.importPath() {
+			p.Order = current.Order
+			o.Plugins[i] = p
+			return
+		}
+	}
+	o.Plugins = append(o.Plugins, p)
+}
+
+// OrderPlugins sets the order of the plugins to the one their import paths are given in,
+// replacing any order a manifest declares.
+func (o *BuildOptions) OrderPlugins(importPaths []string) error {
+	for i := range o.Plugins {
+		o.Plugins[i].Order = 0
+	}
+
+	for position, importPath := range importPaths {
+		found := false
+		for i := range o.Plugins {
+			if o.Plugins[i].importPath() == importPath {
+				o.Plugins[i].Order = position + 1
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("plugin %s is ordered but not part of the build", importPath)
+		}
+	}
+
+	return nil
+}
+
+// WithVars adds the variables given as name=value to the ones available to the main template,
+// replacing the manifest's variables with the same name.
+func (o *BuildOptions) WithVars(vars []string) error {
+	for _, v := range vars {
+		name, value, found := strings.Cut(v, "=")
+		if !found || name == "" {
+			return fmt.Errorf("invalid variable %q, the format is name=value", v)
+		}
+
+		if o.Vars == nil {
+			o.Vars = make(map[string]string)
+		}
+		o.Vars[name] = value
+	}
+	return nil
+}
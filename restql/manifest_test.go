@@ -0,0 +1,118 @@
+package restql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBuildManifest(t *testing.T) {
+	manifest := `
+restql-version: v6.2.0
+restql-replacement: ../restQL-golang
+output: ./bin/restql
+plugins:
+  - module: github.com/user/plugin-a
+    version: v1.2.0
+  - module: github.com/user/plugin-b
+    replace: ../plugin-b
+skip-plugin-validation: true
+`
+	expected := BuildOptions{
+		RestqlVersion:     "v6.2.0",
+		RestqlReplacement: "../restQL-golang",
+		Output:            "./bin/restql",
+		SkipValidation:    true,
+		Plugins: []plugin{
+			{ModulePath: "github.com/user/plugin-a", Version: "v1.2.0"},
+			{ModulePath: "github.com/user/plugin-b", Replace: "../plugin-b"},
+		},
+	}
+
+	got, err := parseBuildManifest([]byte(manifest))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got = %+#v, want = %+#v", got, expected)
+	}
+}
+
+func TestParseBuildManifestWithoutPluginModule(t *testing.T) {
+	manifest := `
+plugins:
+  - version: v1.2.0
+`
+	_, err := parseBuildManifest([]byte(manifest))
+	if err == nil {
+		t.Fatalf("expected an error for a plugin without module")
+	}
+}
+
+func TestBuildOptionsWithPlugins(t *testing.T) {
+	opts := BuildOptions{
+		Plugins: []plugin{
+			{ModulePath: "github.com/user/plugin-a", Version: "v1.2.0"},
+			{ModulePath: "github.com/user/plugin-b", Version: "v0.1.0"},
+		},
+	}
+
+	opts.WithPlugins([]string{"github.com/user/plugin-b@v0.2.0=../plugin-b", "github.com/user/plugin-c"})
+
+	expected := []plugin{
+		{ModulePath: "github.com/user/plugin-a", Version: "v1.2.0"},
+		{ModulePath: "github.com/user/plugin-b", Version: "v0.2.0", Replace: "../plugin-b"},
+		{ModulePath: "github.com/user/plugin-c"},
+	}
+	if !reflect.DeepEqual(opts.Plugins, expected) {
+		t.Fatalf("got = %+#v, want = %+#v", opts.Plugins, expected)
+	}
+}
+
+func TestBuildOptionsOrderPlugins(t *testing.T) {
+	opts := BuildOptions{
+		Plugins: []plugin{
+			{ModulePath: "github.com/user/plugin-a", Order: 1},
+			{ModulePath: "github.com/user/plugin-b"},
+			{ModulePath: "github.com/user/plugin-c", Order: 2},
+		},
+	}
+
+	err := opts.OrderPlugins([]string{"github.com/user/plugin-b", "github.com/user/plugin-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []plugin{
+		{ModulePath: "github.com/user/plugin-a", Order: 2},
+		{ModulePath: "github.com/user/plugin-b", Order: 1},
+		{ModulePath: "github.com/user/plugin-c"},
+	}
+	if !reflect.DeepEqual(opts.Plugins, expected) {
+		t.Fatalf("got = %+#v, want = %+#v", opts.Plugins, expected)
+	}
+
+	err = opts.OrderPlugins([]string{"github.com/user/plugin-d"})
+	if err == nil {
+		t.Fatalf("got = nil, want = error for a plugin that is not part of the build")
+	}
+}
+
+func TestBuildOptionsWithVars(t *testing.T) {
+	opts := BuildOptions{Vars: map[string]string{"logger": "zap", "region": "us"}}
+
+	err := opts.WithVars([]string{"region=br", "banner=a=b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"logger": "zap", "region": "br", "banner": "a=b"}
+	if !reflect.DeepEqual(opts.Vars, expected) {
+		t.Fatalf("got = %v, want = %v", opts.Vars, expected)
+	}
+
+	err = opts.WithVars([]string{"invalid"})
+	if err == nil {
+		t.Fatalf("got = nil, want = error for a variable without value")
+	}
+}
@@ -0,0 +1,197 @@
+package restql
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Fetch resolves the restQL version and plugins listed in the options and stores every module
+// needed to build them in a directory laid out as a module proxy, which is used by offline builds.
+//
+// Modules already present in the directory are kept, so it can gather the modules of several builds.
+func Fetch(ctx context.Context, opts BuildOptions, dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	env, _, err := newBuildEnvironment(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := ioutil.TempDir("", "restql-fetching-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cleanErr := os.RemoveAll(tempDir)
+		if cleanErr != nil {
+			logError("An error occurred when cleaning: %v", cleanErr)
+		}
+	}()
+
+	// an empty module cache makes go download everything the build needs, and only that
+	modCache := filepath.Join(tempDir, "modcache")
+	env.dir = filepath.Join(tempDir, "env")
+	env.Set("GOMODCACHE", modCache)
+	env.Set("GOFLAGS", "-mod=mod -modcacherw")
+
+	err = env.Setup(ctx)
+	if err != nil {
+		return err
+	}
+
+	cmd := env.NewCommand("go", "mod", "download", "all")
+	err = env.RunCommand(ctx, cmd, io.Discard)
+	if err != nil {
+		return err
+	}
+
+	logInfo("Storing modules at: %s", absDir)
+	err = storeDownloadedModules(filepath.Join(modCache, "cache", "download"), absDir)
+	if err != nil {
+		return err
+	}
+
+	return writeProxyLists(absDir)
+}
+
+// UseOffline makes the environment resolve every module from a directory filled by Fetch, without network access.
+func (e *environment) UseOffline(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(absDir)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("offline module directory %s not found, it can be created with the fetch command", absDir)
+	}
+
+	e.offlineDir = absDir
+	e.Set("GOPROXY", fileURL(absDir))
+	e.Set("GOSUMDB", "off")
+	e.Set("GOFLAGS", "-mod=mod")
+	e.Set("GOPRIVATE", "")
+	e.Set("GONOPROXY", "")
+	e.Set("GOTOOLCHAIN", "local")
+
+	return nil
+}
+
+func fileURL(absPath string) string {
+	p := filepath.ToSlash(absPath)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+var pseudoVersionRegexp = regexp.MustCompile(`\d{14}-[0-9a-f]{12}(\+incompatible)?$`)
+
+var (
+	missingModuleRegexp  = regexp.MustCompile(`(\S+@\S+): reading file://`)
+	missingPackageRegexp = regexp.MustCompile(`cannot find module providing package ([^\s:]+)`)
+)
+
+// offlineError explains a command failure caused by a module missing from the offline directory.
+func (e *environment) offlineError(cmdErr *commandError) error {
+	var missing string
+	if matches := missingModuleRegexp.FindStringSubmatch(cmdErr.stderr); len(matches) == 2 {
+		missing = "module " + matches[1]
+	} else if matches := missingPackageRegexp.FindStringSubmatch(cmdErr.stderr); len(matches) == 2 {
+		missing = "the module of package " + matches[1]
+	} else {
+		return cmdErr
+	}
+
+	return fmt.Errorf("%s is missing from the offline module directory %s, fetch it with the same restQL version and plugins: %w",
+		missing, e.offlineDir, cmdErr)
+}
+
+// proxyFileExtensions are the files of the module download cache that a module proxy serves.
+var proxyFileExtensions = map[string]bool{".info": true, ".mod": true, ".zip": true}
+
+// storeDownloadedModules copies the module files from the download cache to the proxy directory.
+func storeDownloadedModules(downloadDir string, proxyDir string) error {
+	return filepath.Walk(downloadDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(downloadDir, path)
+		if err != nil {
+			return err
+		}
+
+		// checksum database tiles are not served by a module proxy
+		if info.IsDir() && rel == "sumdb" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !proxyFileExtensions[filepath.Ext(path)] {
+			return nil
+		}
+
+		target := filepath.Join(proxyDir, rel)
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, content, 0644)
+	})
+}
+
+// writeProxyLists writes the list of tagged versions of every module in the proxy directory,
+// used by go when a version is not informed.
+func writeProxyLists(proxyDir string) error {
+	versions := make(map[string][]string)
+
+	err := filepath.Walk(proxyDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		versionsDir := filepath.Dir(path)
+		if info.IsDir() || filepath.Base(versionsDir) != "@v" || filepath.Ext(path) != ".info" {
+			return nil
+		}
+
+		version := strings.TrimSuffix(filepath.Base(path), ".info")
+		if !pseudoVersionRegexp.MatchString(version) {
+			versions[versionsDir] = append(versions[versionsDir], version)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for versionsDir, vs := range versions {
+		sort.Strings(vs)
+		content := strings.Join(vs, "\n") + "\n"
+		err := ioutil.WriteFile(filepath.Join(versionsDir, "list"), []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package restql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOfflineError(t *testing.T) {
+	tests := []struct {
+		name     string
+		stderr   string
+		expected string
+	}{
+		{
+			"missing module version",
+			"go: github.com/user/plugin@v1.2.0: reading file:///modules/github.com/user/plugin/@v/v1.2.0.info: no such file or directory",
+			"module github.com/user/plugin@v1.2.0 is missing from the offline module directory /modules",
+		},
+		{
+			"missing package",
+			"go: restql imports\n\tgithub.com/user/plugin: cannot find module providing package github.com/user/plugin: module github.com/user/plugin: reading file:///modules/github.com/user/plugin/@v/list: no such file or directory",
+			"the module of package github.com/user/plugin is missing from the offline module directory /modules",
+		},
+		{
+			"unrelated failure",
+			"main.go:3:2: syntax error",
+			"failed to execute command go build",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &environment{offlineDir: "/modules"}
+			cmdErr := &commandError{args: []string{"go", "build"}, stderr: tt.stderr}
+
+			got := env.offlineError(cmdErr).Error()
+			if !strings.HasPrefix(got, tt.expected) {
+				t.Fatalf("got = %s, want prefix = %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteProxyLists(t *testing.T) {
+	dir := t.TempDir()
+	versionsDir := filepath.Join(dir, "github.com", "user", "plugin", "@v")
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files := []string{"v1.1.0.info", "v1.0.0.info", "v1.0.0.mod", "v0.0.0-20210101000000-abcdefabcdef.info", "v0.9.0.mod"}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(versionsDir, f), nil, 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	err := writeProxyLists(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(versionsDir, "list"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "v1.0.0\nv1.1.0\n"
+	if string(got) != expected {
+		t.Fatalf("got = %q, want = %q", got, expected)
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	got := fileURL("/tmp/restql modules")
+	expected := "file:///tmp/restql%20modules"
+	if got != expected {
+		t.Fatalf("got = %s, want = %s", got, expected)
+	}
+}
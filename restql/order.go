@@ -0,0 +1,326 @@
+package restql
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/mod/modfile"
+)
+
+// definedInitOrderGoVersion is the first Go version whose specification defines
+// the order independent packages are initialized in.
+var definedInitOrderGoVersion = semver.MustParse("1.21")
+
+// orderPlugins sorts the plugins by their order, lowest first. Plugins without
+// an order are placed after the ordered ones, keeping the order they were listed.
+func orderPlugins(plugins []plugin) []plugin {
+	ordered := make([]plugin, len(plugins))
+	copy(ordered, plugins)
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i].Order, ordered[j].Order
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+	return ordered
+}
+
+// initOrder returns the import paths of the packages in the order Go initializes them:
+// given the packages sorted by import path, the first one not initialized whose imports
+// already are goes next. Imports not among the packages are assumed to be initialized.
+func initOrder(packages []goPackage) []string {
+	sorted := make([]goPackage, len(packages))
+	copy(sorted, packages)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ImportPath < sorted[j].ImportPath
+	})
+
+	known := make(map[string]bool, len(sorted))
+	for _, p := range sorted {
+		known[p.ImportPath] = true
+	}
+
+	initialized := make(map[string]bool, len(sorted))
+	ready := func(p goPackage) bool {
+		for _, imp := range p.Imports {
+			if known[imp] && !initialized[imp] {
+				return false
+			}
+		}
+		return true
+	}
+
+	order := make([]string, 0, len(sorted))
+	for len(order) < len(sorted) {
+		next := -1
+		for i, p := range sorted {
+			if !initialized[p.ImportPath] && ready(p) {
+				next = i
+				break
+			}
+		}
+		// only an import cycle, which Go does not allow, leaves packages behind
+		if next < 0 {
+			break
+		}
+
+		initialized[sorted[next].ImportPath] = true
+		order = append(order, sorted[next].ImportPath)
+	}
+
+	return order
+}
+
+// orderDir is the directory of the environment holding the copies of the ordered plugins
+// and the go.mod replacing them, ignored by the go commands since it starts with an underscore.
+const orderDir = "_order"
+
+// orderFileName is the name of the file added to the package of the ordered plugins.
+const orderFileName = "zz_restql_order.go"
+
+const orderFileTemplate = `// Code generated by restQL-cli. DO NOT EDIT.
+
+package %s
+
+import _ %q
+`
+
+// setupPluginOrder makes the plugins with an order register in it, before the plugins without one.
+//
+// Blank imports do not decide the order packages are initialized in, Go does it by import path
+// as soon as their imports are initialized. So every ordered plugin after the first is copied with
+// a file importing the plugin ordered before it, and every plugin without an order with a file importing
+// the last ordered one, which Go then initializes first. The copies replace the plugins in a go.mod
+// given to the go commands with -modfile, so the go.mod of the environment, recorded in the lock,
+// and the source of the plugins are not changed.
+func setupPluginOrder(ctx context.Context, env *environment) error {
+	plugins := orderPlugins(env.plugins)
+	env.orderModFile = ""
+	if len(plugins) < 2 || plugins[0].Order == 0 {
+		return nil
+	}
+
+	packages, err := env.listProgramPackages(ctx)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(env.dir, orderDir)
+	if env.dryRun {
+		env.orderModFile = filepath.Join(dir, "go.mod")
+		return nil
+	}
+
+	byPath := make(map[string]goPackage, len(packages))
+	for _, pkg := range packages {
+		byPath[pkg.ImportPath] = pkg
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	goMod, err := ioutil.ReadFile(filepath.Join(env.dir, "go.mod"))
+	if err != nil {
+		return err
+	}
+	f, err := modfile.Parse("go.mod", goMod, nil)
+	if err != nil {
+		return err
+	}
+
+	copies := make(map[string]string)
+	lastOrdered := plugins[0].importPath()
+	for _, p := range plugins[1:] {
+		before, after := lastOrdered, p.importPath()
+		if p.Order != 0 {
+			lastOrdered = after
+		}
+
+		pkg, found := byPath[after]
+		if !found || pkg.Module == nil {
+			return fmt.Errorf("plugin package %s is not part of the program", after)
+		}
+		if containsString(byPath[before].Deps, after) {
+			return fmt.Errorf("plugin %s is ordered before %s, but it imports %s and so always registers after it", before, after, after)
+		}
+
+		m := pkg.Module
+		copyDir, copied := copies[m.Path]
+		if !copied {
+			copyDir = filepath.Join(dir, fmt.Sprintf("%d", len(copies)+1))
+			err = copyModuleSource(m.Dir, copyDir)
+			if err != nil {
+				return err
+			}
+			copies[m.Path] = copyDir
+		}
+
+		pkgDir, err := filepath.Rel(m.Dir, pkg.Dir)
+		if err != nil {
+			return err
+		}
+		content := fmt.Sprintf(orderFileTemplate, pkg.Name, before)
+		err = ioutil.WriteFile(filepath.Join(copyDir, pkgDir, orderFileName), []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+
+		if !copied {
+			err = f.AddReplace(m.Path, "", copyDir, "")
+			if err != nil {
+				return err
+			}
+		}
+		logInfo("Plugin %s registers after %s", after, before)
+	}
+
+	f.Cleanup()
+	content, err := f.Format()
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "go.mod"), content, 0644)
+	if err != nil {
+		return err
+	}
+
+	// the go.sum of an alternate go.mod is the one next to it
+	goSum, err := ioutil.ReadFile(filepath.Join(env.dir, "go.sum"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "go.sum"), goSum, 0644)
+	if err != nil {
+		return err
+	}
+
+	env.orderModFile = filepath.Join(dir, "go.mod")
+	return nil
+}
+
+// copyModuleSource copies the files of a module, skipping hidden and vendor directories, to a writable directory.
+func copyModuleSource(src string, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			if path != src && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		err = copyFile(path, target)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(target, 0644)
+	})
+}
+
+// orderArgs returns the flags making the go commands use the copies of the ordered plugins.
+func (e *environment) orderArgs() []string {
+	if e.orderModFile == "" {
+		return nil
+	}
+	return []string{"-modfile=" + e.orderModFile}
+}
+
+// checkPluginOrder verifies that the plugins with an order register in it, given the packages
+// listed with the copies made by setupPluginOrder, and warns about plugins implementing
+// the same hook when some of them have no order.
+func checkPluginOrder(ctx context.Context, env *environment, packages []goPackage, registrations []pluginRegistration) error {
+	if len(registrations) < 2 {
+		return nil
+	}
+
+	goVersion, current, err := env.goVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.LessThan(definedInitOrderGoVersion) {
+		logWarn("Go %s does not define the order packages are initialized in, the order plugins without an order register in is not known", goVersion)
+		return nil
+	}
+
+	position := make(map[string]int, len(packages))
+	for i, importPath := range initOrder(packages) {
+		position[importPath] = i
+	}
+
+	var ordered []plugin
+	orders := make(map[string]int, len(env.plugins))
+	for _, p := range orderPlugins(env.plugins) {
+		orders[p.importPath()] = p.Order
+		if p.Order != 0 {
+			ordered = append(ordered, p)
+		}
+	}
+
+	for i := 1; i < len(ordered); i++ {
+		before, after := ordered[i-1].importPath(), ordered[i].importPath()
+		if position[before] > position[after] {
+			return fmt.Errorf("plugin %s is ordered before %s, but Go initializes %s first", before, after, after)
+		}
+	}
+
+	sorted := make([]pluginRegistration, len(registrations))
+	copy(sorted, registrations)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return position[sorted[i].importPath] < position[sorted[j].importPath]
+	})
+
+	registered := make([]string, len(sorted))
+	for i, r := range sorted {
+		registered[i] = r.importPath
+	}
+	logInfo("Plugins register in the order: %s", strings.Join(registered, ", "))
+
+	for _, hook := range env.adapter.pluginAPI.hooks {
+		var implementing []string
+		unordered := false
+		for _, r := range sorted {
+			if !containsString(r.hooks, hook) {
+				continue
+			}
+			implementing = append(implementing, r.importPath)
+			unordered = unordered || orders[r.importPath] == 0
+		}
+
+		if len(implementing) > 1 && unordered {
+			logWarn("Plugins %s implement %s without an explicit order, they run in the order Go initializes them", strings.Join(implementing, ", "), hook)
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
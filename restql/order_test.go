@@ -0,0 +1,176 @@
+package restql
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOrderPlugins(t *testing.T) {
+	plugins := []plugin{
+		{ModulePath: "github.com/user/plugin-a"},
+		{ModulePath: "github.com/user/plugin-b", Order: 2},
+		{ModulePath: "github.com/user/plugin-c"},
+		{ModulePath: "github.com/user/plugin-d", Order: 1},
+	}
+
+	got := orderPlugins(plugins)
+	expected := []plugin{plugins[3], plugins[1], plugins[0], plugins[2]}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got = %+v, want = %+v", got, expected)
+	}
+}
+
+func TestInitOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		packages []goPackage
+		expected []string
+	}{
+		{
+			"when packages are independent, they are initialized by import path",
+			[]goPackage{
+				{ImportPath: "github.com/user/plugin-b"},
+				{ImportPath: "github.com/user/plugin-a"},
+			},
+			[]string{"github.com/user/plugin-a", "github.com/user/plugin-b"},
+		},
+		{
+			"when a package waits for its imports, a later one by import path goes first",
+			[]goPackage{
+				{ImportPath: "github.com/user/plugin-a", Imports: []string{"gopkg.in/yaml.v3"}},
+				{ImportPath: "github.com/user/plugin-b", Imports: []string{"fmt"}},
+				{ImportPath: "gopkg.in/yaml.v3", Imports: []string{"fmt"}},
+				{ImportPath: "fmt"},
+				{ImportPath: "restql", Imports: []string{"github.com/user/plugin-a", "github.com/user/plugin-b"}},
+			},
+			[]string{"fmt", "github.com/user/plugin-b", "gopkg.in/yaml.v3", "github.com/user/plugin-a", "restql"},
+		},
+		{
+			"when an import is not among the packages, it is assumed initialized",
+			[]goPackage{
+				{ImportPath: "github.com/user/plugin-a", Imports: []string{"C", "unsafe"}},
+			},
+			[]string{"github.com/user/plugin-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := initOrder(tt.packages)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("got = %v, want = %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckPluginOrder(t *testing.T) {
+	packages := []goPackage{
+		{ImportPath: "github.com/user/plugin-a"},
+		{ImportPath: "github.com/user/plugin-b"},
+	}
+	registrations := []pluginRegistration{
+		{importPath: "github.com/user/plugin-a", hooks: []string{"BeforeTransaction"}},
+		{importPath: "github.com/user/plugin-b", hooks: []string{"BeforeTransaction"}},
+	}
+
+	tests := []struct {
+		name        string
+		orders      []int
+		expectedErr bool
+	}{
+		{"when the order is the one Go initializes the plugins in, it passes", []int{1, 2}, false},
+		{"when the order is not the one Go initializes the plugins in, it fails", []int{2, 1}, true},
+		{"when the plugins have no order, it passes", []int{0, 0}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins := []plugin{
+				{ModulePath: "github.com/user/plugin-a", Order: tt.orders[0]},
+				{ModulePath: "github.com/user/plugin-b", Order: tt.orders[1]},
+			}
+			env := newEnvironment("", plugins, "v6.2.0")
+
+			err := checkPluginOrder(context.Background(), env, packages, registrations)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("got = %v, want error = %t", err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestSetupPluginOrder(t *testing.T) {
+	pluginFiles := func(name string) map[string]string {
+		return map[string]string{
+			"go.mod":    fmt.Sprintf("module example.com/%s\n\ngo 1.18\n\nrequire example.com/restql/v6 v6.2.0\n", name),
+			"plugin.go": fmt.Sprintf("package %s\n\nimport \"example.com/restql/v6/pkg/restql\"\n\nfunc init() {\n\trestql.RegisterPlugin(restql.PluginInfo{Name: %q})\n}\n", name, name),
+		}
+	}
+	proxyDir := writeTestProxy(t, []testModule{
+		{path: "example.com/restql/v6", version: "v6.2.0", files: map[string]string{
+			"go.mod":               "module example.com/restql/v6\n\ngo 1.18\n",
+			"cmd/cmd.go":           "package cmd\n\nvar build string\n\nfunc Start() {}\n",
+			"pkg/restql/restql.go": "package restql\n\nimport \"fmt\"\n\ntype PluginInfo struct {\n\tName string\n}\n\nfunc RegisterPlugin(p PluginInfo) {\n\tfmt.Println(p.Name)\n}\n",
+		}},
+		{path: "example.com/aplugin", version: "v1.0.0", files: pluginFiles("aplugin")},
+		{path: "example.com/bplugin", version: "v1.0.0", files: pluginFiles("bplugin")},
+		{path: "example.com/cplugin", version: "v1.0.0", files: pluginFiles("cplugin")},
+	})
+
+	tests := []struct {
+		name     string
+		orders   []int
+		expected string
+	}{
+		{"when the plugins have no order, they register by import path", []int{0, 0, 0}, "aplugin\nbplugin\ncplugin\n"},
+		{"when the order is the reverse of the import paths, it is followed", []int{3, 2, 1}, "cplugin\nbplugin\naplugin\n"},
+		{"when only some plugins have an order, they register in it", []int{2, 0, 1}, "cplugin\naplugin\nbplugin\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins := []plugin{
+				{ModulePath: "example.com/aplugin", Version: "v1.0.0", Order: tt.orders[0]},
+				{ModulePath: "example.com/bplugin", Version: "v1.0.0", Order: tt.orders[1]},
+				{ModulePath: "example.com/cplugin", Version: "v1.0.0", Order: tt.orders[2]},
+			}
+			env := newEnvironment(filepath.Join(t.TempDir(), "env"), orderPlugins(plugins), "v6.2.0")
+			env.UseRestqlModule("example.com/restql")
+			useTestProxy(t, env, proxyDir)
+			env.Set("CGO_ENABLED", 0)
+
+			ctx := context.Background()
+			err := env.Setup(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = setupPluginOrder(ctx, env)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = validatePlugins(ctx, env)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			binary := filepath.Join(env.dir, executableName("restql"))
+			err = runGoBuild(ctx, env, "v6.2.0", binary)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			out, err := exec.Command(binary).Output()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(out) != tt.expected {
+				t.Fatalf("got = %q, want = %q", out, tt.expected)
+			}
+		})
+	}
+}
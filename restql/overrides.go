@@ -0,0 +1,154 @@
+package restql
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// dependencyOverrides are changes to the module graph of restQL and the plugins given by the user,
+// written as go mod edit expects them: old[@version]=new for replacements and module@version otherwise.
+type dependencyOverrides struct {
+	Replace []string `json:"replace,omitempty"`
+	Require []string `json:"require,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// newDependencyOverrides validates the overrides, making the paths of local replacements absolute.
+func newDependencyOverrides(replace []string, require []string, exclude []string) (dependencyOverrides, error) {
+	var o dependencyOverrides
+
+	for _, r := range replace {
+		old, replacement, found := strings.Cut(r, "=")
+		if !found || old == "" || replacement == "" {
+			return dependencyOverrides{}, fmt.Errorf("invalid replacement %q, the format is module[@version]=path or module[@version]=module@version", r)
+		}
+
+		oldPath, oldVersion := splitModuleVersion(old)
+		err := checkModuleVersion(oldPath, oldVersion, false)
+		if err != nil {
+			return dependencyOverrides{}, fmt.Errorf("invalid replacement %q: %v", r, err)
+		}
+
+		if isLocalPath(replacement) {
+			absReplacement, err := filepath.Abs(replacement)
+			if err != nil {
+				return dependencyOverrides{}, err
+			}
+			replacement = absReplacement
+		} else {
+			newPath, newVersion := splitModuleVersion(replacement)
+			err := checkModuleVersion(newPath, newVersion, true)
+			if err != nil {
+				return dependencyOverrides{}, fmt.Errorf("invalid replacement %q, a module replacement needs a version: %v", r, err)
+			}
+		}
+
+		o.Replace = append(o.Replace, old+"="+replacement)
+	}
+
+	for _, r := range require {
+		path, version := splitModuleVersion(r)
+		err := checkModuleVersion(path, version, true)
+		if err != nil {
+			return dependencyOverrides{}, fmt.Errorf("invalid requirement %q, the format is module@version: %v", r, err)
+		}
+		o.Require = append(o.Require, r)
+	}
+
+	for _, e := range exclude {
+		path, version := splitModuleVersion(e)
+		err := checkModuleVersion(path, version, true)
+		if err != nil {
+			return dependencyOverrides{}, fmt.Errorf("invalid exclusion %q, the format is module@version: %v", e, err)
+		}
+		o.Exclude = append(o.Exclude, e)
+	}
+
+	return o, nil
+}
+
+// isLocalPath reports if the replacement is a directory, which go requires to start with ./, ../ or be absolute.
+func isLocalPath(replacement string) bool {
+	return strings.HasPrefix(replacement, "./") || strings.HasPrefix(replacement, "../") || filepath.IsAbs(replacement)
+}
+
+// checkModuleVersion validates the module path and its version, which must be a semantic version
+// since it is written in the go.mod without being resolved.
+func checkModuleVersion(path string, version string, versionRequired bool) error {
+	err := module.CheckPath(path)
+	if err != nil {
+		return err
+	}
+
+	if version == "" {
+		if versionRequired {
+			return fmt.Errorf("missing version of %s", path)
+		}
+		return nil
+	}
+	if !semver.IsValid(version) {
+		return fmt.Errorf("version %s of %s is not a semantic version", version, path)
+	}
+	return nil
+}
+
+// UseDependencyOverrides sets the replacements, requirements and exclusions applied to the go.mod before pinning versions.
+func (e *environment) UseDependencyOverrides(o dependencyOverrides) {
+	e.overrides = o
+}
+
+// replacements splits the replacements of the overrides in their old and new sides.
+func (o dependencyOverrides) replacements() [][2]string {
+	replaces := make([][2]string, len(o.Replace))
+	for i, r := range o.Replace {
+		old, replacement, _ := strings.Cut(r, "=")
+		replaces[i] = [2]string{old, replacement}
+	}
+	return replaces
+}
+
+// sameAs reports if both overrides change the same modules. The new side of local replacements is
+// not compared, since it is an absolute path that changes from one machine to another.
+func (o dependencyOverrides) sameAs(other dependencyOverrides) bool {
+	return sameStrings(o.replacedModules(), other.replacedModules()) &&
+		sameStrings(o.Require, other.Require) &&
+		sameStrings(o.Exclude, other.Exclude)
+}
+
+func (o dependencyOverrides) replacedModules() []string {
+	var modules []string
+	for _, r := range o.replacements() {
+		if isLocalPath(r[1]) {
+			modules = append(modules, r[0])
+		} else {
+			modules = append(modules, r[0]+"="+r[1])
+		}
+	}
+	return modules
+}
+
+func (o dependencyOverrides) isEmpty() bool {
+	return len(o.Replace) == 0 && len(o.Require) == 0 && len(o.Exclude) == 0
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
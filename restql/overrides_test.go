@@ -0,0 +1,134 @@
+package restql
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewDependencyOverrides(t *testing.T) {
+	absLib, err := filepath.Abs("../lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := newDependencyOverrides(
+		[]string{"github.com/other/lib=../lib", "github.com/other/json@v1.2.0=github.com/fork/json@v1.2.1"},
+		[]string{"golang.org/x/net@v0.17.0"},
+		[]string{"github.com/other/bad@v1.3.0"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := dependencyOverrides{
+		Replace: []string{"github.com/other/lib=" + absLib, "github.com/other/json@v1.2.0=github.com/fork/json@v1.2.1"},
+		Require: []string{"golang.org/x/net@v0.17.0"},
+		Exclude: []string{"github.com/other/bad@v1.3.0"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got = %+v, want = %+v", got, expected)
+	}
+}
+
+func TestNewDependencyOverridesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace []string
+		require []string
+		exclude []string
+	}{
+		{"when a replacement has no new side, it fails", []string{"github.com/other/lib"}, nil, nil},
+		{"when a module replacement has no version, it fails", []string{"github.com/other/lib=github.com/fork/lib"}, nil, nil},
+		{"when a requirement has no version, it fails", nil, []string{"golang.org/x/net"}, nil},
+		{"when an exclusion has no version, it fails", nil, nil, []string{"github.com/other/bad@"}},
+		{"when a requirement is not a semantic version, it fails", nil, []string{"golang.org/x/net@master"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newDependencyOverrides(tt.replace, tt.require, tt.exclude)
+			if err == nil {
+				t.Fatalf("got = nil, want = error")
+			}
+		})
+	}
+}
+
+func TestDependencyOverridesSameAs(t *testing.T) {
+	locked := dependencyOverrides{
+		Replace: []string{"github.com/other/lib=/home/ci/lib", "github.com/other/json=github.com/fork/json@v1.2.1"},
+		Require: []string{"golang.org/x/net@v0.17.0"},
+	}
+
+	tests := []struct {
+		name      string
+		overrides dependencyOverrides
+		expected  bool
+	}{
+		{
+			"when local replacements point to another directory, they are the same",
+			dependencyOverrides{
+				Replace: []string{"github.com/other/json=github.com/fork/json@v1.2.1", "github.com/other/lib=/home/dev/lib"},
+				Require: []string{"golang.org/x/net@v0.17.0"},
+			},
+			true,
+		},
+		{
+			"when a module replacement changes version, they differ",
+			dependencyOverrides{
+				Replace: []string{"github.com/other/lib=/home/ci/lib", "github.com/other/json=github.com/fork/json@v1.2.2"},
+				Require: []string{"golang.org/x/net@v0.17.0"},
+			},
+			false,
+		},
+		{
+			"when an exclusion is added, they differ",
+			dependencyOverrides{
+				Replace: locked.Replace,
+				Require: locked.Require,
+				Exclude: []string{"github.com/other/bad@v1.3.0"},
+			},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.overrides.sameAs(locked)
+			if got != tt.expected {
+				t.Fatalf("got = %v, want = %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEnvironmentHasLocalReplacement(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugins  []plugin
+		replace  []string
+		expected bool
+	}{
+		{"when nothing is replaced, there is none", []plugin{{ModulePath: "github.com/user/plugin"}}, nil, false},
+		{"when a plugin is replaced by a directory, there is one", []plugin{{ModulePath: "github.com/user/plugin", Replace: "../plugin"}}, nil, true},
+		{"when a dependency is replaced by a directory, there is one", []plugin{{ModulePath: "github.com/user/plugin"}}, []string{"github.com/other/lib=../lib"}, true},
+		{"when a dependency is replaced by another module, there is none", []plugin{{ModulePath: "github.com/user/plugin"}}, []string{"github.com/other/lib=github.com/fork/lib@v1.0.0"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides, err := newDependencyOverrides(tt.replace, nil, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			env := newEnvironment("", tt.plugins, "v6.2.0")
+			env.UseDependencyOverrides(overrides)
+			got := env.hasLocalReplacement()
+			if got != tt.expected {
+				t.Fatalf("got = %t, want = %t", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package restql
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// plannedFile is a file the environment would write if it was not in dry run.
+type plannedFile struct {
+	name    string
+	content []byte
+}
+
+// plannedCommand is a command the environment would execute, along with
+// the variables injected by the CLI that changed since the previous command.
+type plannedCommand struct {
+	vars []string
+	args []string
+}
+
+// DryRun makes the environment record the files it would write and the commands
+// it would execute instead of doing it, so they can be reported with WritePlan.
+func (e *environment) DryRun() {
+	e.dryRun = true
+}
+
+// WritePlan reports everything the environment recorded in dry run: the generated files,
+// including the go.mod, the variables injected by the CLI and the ordered go commands.
+func (e *environment) WritePlan(out io.Writer) error {
+	fmt.Fprintf(out, "# Working directory: %s\n", e.dir)
+
+	for _, f := range e.plannedFiles {
+		fmt.Fprintf(out, "\n# %s\n", f.name)
+		fmt.Fprintf(out, "%s\n", strings.TrimSpace(string(f.content)))
+	}
+
+	fmt.Fprintf(out, "\n# Environment variables and commands\n")
+	for _, c := range e.plannedCommands {
+		if len(c.vars) > 0 {
+			fmt.Fprintf(out, "export %s\n", formatCommand(c.vars))
+		}
+		fmt.Fprintf(out, "%s\n", formatCommand(c.args))
+	}
+
+	return nil
+}
+
+func (e *environment) planCommand(cmd *exec.Cmd) {
+	if e.plannedVars == nil {
+		e.plannedVars = make(map[string]string)
+	}
+
+	var changed []string
+	for _, key := range e.injectedVars {
+		v, ok := e.Get(key).(string)
+		if !ok || e.plannedVars[key] == v {
+			continue
+		}
+		e.plannedVars[key] = v
+		changed = append(changed, v)
+	}
+
+	e.plannedCommands = append(e.plannedCommands, plannedCommand{vars: changed, args: cmd.Args})
+}
+
+// formatCommand renders the command arguments as they would be typed in a shell.
+func formatCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\"'$") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,131 @@
+package restql
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatCommand(t *testing.T) {
+	got := formatCommand([]string{"go", "build", "-ldflags", "-s -w -X main.name=it's", "-tags", "netgo"})
+	expected := `go build -ldflags '-s -w -X main.name=it'\''s' -tags netgo`
+	if got != expected {
+		t.Fatalf("got = %s, want = %s", got, expected)
+	}
+}
+
+func TestEnvironmentWritePlan(t *testing.T) {
+	plugins := []plugin{
+		{ModulePath: "github.com/user/plugin-a", Version: "v1.0.0", Replace: "/plugins/a"},
+		{ModulePath: "github.com/user/plugin-b"},
+	}
+	env := newEnvironment("/tmp/restql-env", plugins, "v6.2.0")
+	env.DryRun()
+
+	err := env.Setup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	env.Set("GOOS", "linux")
+	err = env.RunCommand(context.Background(), env.NewCommand("go", "build"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	err = env.WritePlan(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plan := out.String()
+
+	expectedParts := []string{
+		"# Working directory: /tmp/restql-env",
+		`_ "github.com/user/plugin-a"`,
+		"# go.mod\nmodule restql\n",
+		"require (\n\tgithub.com/b2wdigital/restQL-golang/v6 v6.2.0\n\tgithub.com/user/plugin-a v1.0.0\n)\n",
+		"replace github.com/user/plugin-a => /plugins/a\n",
+		"go get -d -v github.com/user/plugin-b\ngo mod tidy\n",
+		"export GOOS=linux\ngo build\n",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(plan, part) {
+			t.Fatalf("plan does not contain %q:\n%s", part, plan)
+		}
+	}
+}
+
+func TestEnvironmentWritePlanWithOverrides(t *testing.T) {
+	env := newEnvironment("/tmp/restql-env", []plugin{{ModulePath: "github.com/user/plugin-a", Version: "v1.0.0"}}, "v6.2.0")
+	env.UseDependencyOverrides(dependencyOverrides{
+		Replace: []string{"github.com/other/json@v1.2.0=github.com/fork/json@v1.2.1"},
+		Require: []string{"golang.org/x/net@v0.17.0"},
+		Exclude: []string{"github.com/other/bad@v1.3.0"},
+	})
+	env.DryRun()
+
+	err := env.Setup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	err = env.WritePlan(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plan := out.String()
+
+	expectedParts := []string{
+		"\tgolang.org/x/net v0.17.0\n",
+		"exclude github.com/other/bad v1.3.0\n",
+		"replace github.com/other/json v1.2.0 => github.com/fork/json v1.2.1\n",
+		"# Environment variables and commands\ngo env GOVERSION\ngo mod tidy\n",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(plan, part) {
+			t.Fatalf("plan does not contain %q:\n%s", part, plan)
+		}
+	}
+}
+
+func TestRunBuildStepsPlansEveryCommand(t *testing.T) {
+	env := newEnvironment("/tmp/restql-env", []plugin{{ModulePath: "github.com/user/plugin-a", Version: "v1.0.0"}}, "v6.2.0")
+	env.DryRun()
+
+	opts := BuildOptions{RestqlVersion: "v6.2.0", ExplainDeps: true, SBOM: sbomCycloneDX, Image: "restql.tar"}
+	err := runBuildSteps(context.Background(), env, nil, opts, "/tmp/restql", "/tmp/restql.lock", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	err = env.WritePlan(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var commands []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "go ") {
+			commands = append(commands, strings.Join(strings.Fields(line)[:3], " "))
+		}
+	}
+
+	expected := []string{
+		"go list -m",
+		"go mod edit",
+		"go list -deps",
+		"go mod graph",
+		"go list -m",
+		"go build -o",
+		"go list -m",
+		"go env GOOS",
+		"go list -m",
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("got = %v, want = %v\n%s", commands, expected, out.String())
+	}
+}
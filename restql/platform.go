@@ -0,0 +1,76 @@
+package restql
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const defaultOutputTemplate = "restql-{{.Version}}-{{.OS}}-{{.Arch}}"
+
+// platform is a compilation target in the GOOS/GOARCH form, like linux/amd64.
+type platform struct {
+	OS   string
+	Arch string
+}
+
+func (p platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+func parsePlatform(target string) (platform, error) {
+	parts := strings.Split(strings.TrimSpace(target), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return platform{}, fmt.Errorf("invalid platform %q, expected the os/arch format", target)
+	}
+
+	return platform{OS: parts[0], Arch: parts[1]}, nil
+}
+
+// parsePlatforms accepts each target as a separate entry or as a comma separated list.
+func parsePlatforms(targets []string) ([]platform, error) {
+	var platforms []platform
+	for _, t := range targets {
+		for _, target := range strings.Split(t, ",") {
+			p, err := parsePlatform(target)
+			if err != nil {
+				return nil, err
+			}
+			platforms = append(platforms, p)
+		}
+	}
+
+	return platforms, nil
+}
+
+type outputTemplateContext struct {
+	Version string
+	OS      string
+	Arch    string
+}
+
+// platformOutputName renders the binary name for the platform, adding the .exe extension for windows.
+func platformOutputName(outputTemplate string, restqlVersion string, p platform) (string, error) {
+	if outputTemplate == "" {
+		outputTemplate = defaultOutputTemplate
+	}
+
+	tpl, err := template.New("output").Parse(outputTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid output template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, outputTemplateContext{Version: restqlVersion, OS: p.OS, Arch: p.Arch})
+	if err != nil {
+		return "", err
+	}
+
+	name := buf.String()
+	if p.OS == "windows" && !strings.HasSuffix(name, ".exe") {
+		name += ".exe"
+	}
+
+	return name, nil
+}
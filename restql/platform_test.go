@@ -0,0 +1,92 @@
+package restql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string
+		expected    []platform
+		expectError bool
+	}{
+		{
+			"when given no platforms, return none",
+			nil,
+			nil,
+			false,
+		},
+		{
+			"when given platforms in separate entries and comma separated lists, return all of them",
+			[]string{"linux/amd64,linux/arm64", "darwin/arm64"},
+			[]platform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}, {OS: "darwin", Arch: "arm64"}},
+			false,
+		},
+		{
+			"when given a platform without arch, return an error",
+			[]string{"linux"},
+			nil,
+			true,
+		},
+		{
+			"when given a platform with extra components, return an error",
+			[]string{"linux/arm/v7"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePlatforms(tt.input)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("got error = %v, expect error = %v", err, tt.expectError)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("got = %+#v, want = %+#v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPlatformOutputName(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		platform platform
+		expected string
+	}{
+		{
+			"when given no template, use the default one",
+			"",
+			platform{OS: "linux", Arch: "amd64"},
+			"restql-v6.2.0-linux-amd64",
+		},
+		{
+			"when given a custom template, render it",
+			"custom-{{.OS}}_{{.Arch}}",
+			platform{OS: "darwin", Arch: "arm64"},
+			"custom-darwin_arm64",
+		},
+		{
+			"when building for windows, add the exe extension",
+			"",
+			platform{OS: "windows", Arch: "amd64"},
+			"restql-v6.2.0-windows-amd64.exe",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := platformOutputName(tt.template, "v6.2.0", tt.platform)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Fatalf("got = %s, want = %s", got, tt.expected)
+			}
+		})
+	}
+}
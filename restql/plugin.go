@@ -1,13 +1,22 @@
 package restql
 
-import "regexp"
+import (
+	"fmt"
+	"regexp"
+)
 
-var pluginInfoRegex = regexp.MustCompile("([^@=]+)@?([^=]*)=?(.*)")
+var pluginInfoRegex = regexp.MustCompile("^([^@=]+?)(?:@([^=]*?))?(?://([^=]*))?(?:=(.*))?$")
 
 type plugin struct {
-	ModulePath string
-	Version    string
-	Replace    string
+	ModulePath string `yaml:"module"`
+	Version    string `yaml:"version"`
+	Replace    string `yaml:"replace"`
+	// Package is the path of the plugin package inside the module, when it is not the module root
+	Package string `yaml:"package"`
+	// Order is the position the plugin registers in restQL, plugins with a lower order register first
+	Order int `yaml:"order"`
+	// Range is the version range requested, when the version was resolved from one
+	Range string `yaml:"-"`
 }
 
 func parsePluginInfo(pluginInfo string) plugin {
@@ -33,9 +42,53 @@ func parsePluginInfo(pluginInfo string) plugin {
 	}
 
 	if len(submatches) >= 4 {
-		r := submatches[3]
+		pkg := submatches[3]
+		p.Package = pkg
+	}
+
+	if len(submatches) >= 5 {
+		r := submatches[4]
 		p.Replace = r
 	}
 
 	return p
 }
+
+// importPath returns the path the plugin package is imported by.
+func (p plugin) importPath() string {
+	if p.Package == "" {
+		return p.ModulePath
+	}
+	return p.ModulePath + "/" + p.Package
+}
+
+// pluginModules returns the first plugin of each module, for the steps that fetch, replace and pin modules.
+func pluginModules(plugins []plugin) []plugin {
+	seen := make(map[string]bool, len(plugins))
+	var modules []plugin
+	for _, p := range plugins {
+		if seen[p.ModulePath] {
+			continue
+		}
+		seen[p.ModulePath] = true
+		modules = append(modules, p)
+	}
+	return modules
+}
+
+// checkPluginModules fails when plugins of the same module ask for different versions or replacements.
+func checkPluginModules(plugins []plugin) error {
+	byModule := make(map[string]plugin, len(plugins))
+	for _, p := range plugins {
+		first, found := byModule[p.ModulePath]
+		if !found {
+			byModule[p.ModulePath] = p
+			continue
+		}
+
+		if first.Version != p.Version || first.Replace != p.Replace {
+			return fmt.Errorf("plugins %s and %s are from the same module %s, but ask for different versions or replacements", first.importPath(), p.importPath(), p.ModulePath)
+		}
+	}
+	return nil
+}
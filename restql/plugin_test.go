@@ -48,6 +48,24 @@ func TestParsePluginInfo(t *testing.T) {
 				Replace:    "../replace/path",
 			},
 		},
+		{
+			"when given an plugin info with the module name and package return an plugin with they",
+			"github.com/org/plugins//auth",
+			plugin{
+				ModulePath: "github.com/org/plugins",
+				Package:    "auth",
+			},
+		},
+		{
+			"when given an plugin info with the module name, version, package and replace path return an plugin with they",
+			"github.com/org/plugins@v1.0.0//auth/v2=../replace/path",
+			plugin{
+				ModulePath: "github.com/org/plugins",
+				Version:    "v1.0.0",
+				Package:    "auth/v2",
+				Replace:    "../replace/path",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -59,3 +77,48 @@ func TestParsePluginInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestPluginImportPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   plugin
+		expected string
+	}{
+		{"when there is no package, the module is imported", plugin{ModulePath: "github.com/user/plugin"}, "github.com/user/plugin"},
+		{"when there is a package, it is imported from the module", plugin{ModulePath: "github.com/org/plugins", Package: "auth"}, "github.com/org/plugins/auth"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.plugin.importPath()
+			if got != tt.expected {
+				t.Fatalf("got = %s, want = %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPluginModules(t *testing.T) {
+	plugins := []plugin{
+		{ModulePath: "github.com/org/plugins", Version: "v1.0.0", Package: "auth"},
+		{ModulePath: "github.com/user/plugin"},
+		{ModulePath: "github.com/org/plugins", Version: "v1.0.0", Package: "cache"},
+	}
+
+	got := pluginModules(plugins)
+	expected := []plugin{plugins[0], plugins[1]}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got = %+v, want = %+v", got, expected)
+	}
+
+	err := checkPluginModules(plugins)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	plugins[2].Version = "v1.1.0"
+	err = checkPluginModules(plugins)
+	if err == nil {
+		t.Fatalf("got = nil, want = error for plugins of the same module at different versions")
+	}
+}
@@ -0,0 +1,117 @@
+package restql
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// commandGracePeriod is how long an interrupted command has to exit before it is killed.
+var commandGracePeriod = 10 * time.Second
+
+// process is a command started in a process group of its own, so the processes it
+// starts, like the restQL spawned by go run, are stopped along with it.
+// runningProcesses are the processes started and not exited yet, killed by KillCommands.
+var runningProcesses = struct {
+	sync.Mutex
+	processes map[*process]struct{}
+}{processes: make(map[*process]struct{})}
+
+type process struct {
+	cmd      *exec.Cmd
+	exited   chan struct{}
+	stopping chan struct{}
+	err      error
+}
+
+func startProcess(cmd *exec.Cmd) (*process, error) {
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &process{cmd: cmd, exited: make(chan struct{}), stopping: make(chan struct{})}
+	runningProcesses.Lock()
+	runningProcesses.processes[p] = struct{}{}
+	runningProcesses.Unlock()
+
+	go func() {
+		p.err = cmd.Wait()
+
+		runningProcesses.Lock()
+		delete(runningProcesses.processes, p)
+		runningProcesses.Unlock()
+		close(p.exited)
+	}()
+
+	return p, nil
+}
+
+// stop asks the process group to terminate and, if it is still running after
+// the grace period, kills it. It returns once the process has exited and must
+// not be called again before that.
+func (p *process) stop() {
+	select {
+	case <-p.exited:
+		return
+	default:
+	}
+
+	close(p.stopping)
+	logWarn("Stopping command: %s", formatCommand(p.cmd.Args))
+	err := terminateProcessGroup(p.cmd.Process)
+	if err != nil {
+		logError("An error occurred when stopping the command: %v", err)
+	}
+
+	timer := time.NewTimer(commandGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-p.exited:
+	case <-timer.C:
+		logWarn("Command did not stop in %s, killing it", commandGracePeriod)
+		err = killProcessGroup(p.cmd.Process)
+		if err != nil {
+			logError("An error occurred when killing the command: %v", err)
+		}
+		<-p.exited
+	}
+}
+
+// runProcess runs the command until it exits or the context is done, when it is
+// stopped and the context error returned.
+func runProcess(ctx context.Context, cmd *exec.Cmd) error {
+	p, err := startProcess(cmd)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-p.exited:
+		return p.err
+	case <-ctx.Done():
+	}
+
+	p.stop()
+	return ctx.Err()
+}
+
+// KillCommands kills the process group of every command still running, without waiting
+// for the grace period. It is meant for when the CLI must exit at once, since the commands
+// run in process groups of their own and would not be stopped along with it.
+func KillCommands() {
+	runningProcesses.Lock()
+	defer runningProcesses.Unlock()
+
+	for p := range runningProcesses.processes {
+		logWarn("Killing command: %s", formatCommand(p.cmd.Args))
+		err := killProcessGroup(p.cmd.Process)
+		if err != nil {
+			logError("An error occurred when killing the command: %v", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//go:build !windows
+
+package restql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunProcess(t *testing.T) {
+	err := runProcess(context.Background(), exec.Command("sh", "-c", "exit 0"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = runProcess(context.Background(), exec.Command("sh", "-c", "exit 3"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("got = %v, want = exit status 3", err)
+	}
+}
+
+func TestRunProcessStopsProcessGroup(t *testing.T) {
+	gracePeriod := commandGracePeriod
+	defer func() { commandGracePeriod = gracePeriod }()
+	commandGracePeriod = 100 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"when the context is done, the processes started by the command are terminated", "sleep 60 & wait"},
+		{"when the processes ignore the termination, they are killed after the grace period", `trap "" TERM; sleep 60 & wait`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			// the output pipe is only closed when the sleep started by the shell exits too
+			var out bytes.Buffer
+			cmd := exec.Command("sh", "-c", tt.script)
+			cmd.Stdout = &out
+
+			started := time.Now()
+			err := runProcess(ctx, cmd)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got = %v, want = %v", err, context.Canceled)
+			}
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Fatalf("got = stopped in %s, want = stopped in less than 5s", elapsed)
+			}
+		})
+	}
+}
+
+func TestKillCommands(t *testing.T) {
+	p, err := startProcess(exec.Command("sh", "-c", `trap "" TERM; sleep 60 & wait`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	KillCommands()
+
+	select {
+	case <-p.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("got = command running, want = command killed")
+	}
+
+	runningProcesses.Lock()
+	defer runningProcesses.Unlock()
+	if _, ok := runningProcesses.processes[p]; ok {
+		t.Fatalf("got = command still registered, want = command removed once exited")
+	}
+}
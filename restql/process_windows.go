@@ -0,0 +1,35 @@
+//go:build windows
+
+package restql
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+var generateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// terminateProcessGroup sends a CTRL_BREAK_EVENT to the process group led by the process,
+// which Go programs receive as an interrupt.
+func terminateProcessGroup(p *os.Process) error {
+	r, _, err := generateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(p.Pid))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// killProcessGroup kills the process and every process it started, since Windows
+// has no signal to kill a process group.
+func killProcessGroup(p *os.Process) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run()
+}
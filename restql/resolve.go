@@ -0,0 +1,172 @@
+package restql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+var versionRangeRegexp = regexp.MustCompile(`^\s*(!=|[<>]=?|=)|^[\^~]|(^|\.)[*xX](\.|$)|,|\|\|| - `)
+
+// isVersionRange reports if the plugin version is a range, like ^1.4, ~1.4.0 or >=1.4.0,
+// instead of something go understands by itself, like a version, a branch or a commit.
+func isVersionRange(version string) bool {
+	return versionRangeRegexp.MatchString(version)
+}
+
+// resolvePluginVersions replaces the version ranges of the plugins by the highest version that satisfies them.
+//
+// Locked builds take the version recorded in the lock, which was verified to satisfy the range.
+// Otherwise, the versions available are listed by go from the @v/list endpoint of the module proxy.
+func resolvePluginVersions(ctx context.Context, env *environment, lock *lockFile) error {
+	plugins := make([]plugin, len(env.plugins))
+	copy(plugins, env.plugins)
+
+	resolved := make(map[string]string)
+	for i, p := range plugins {
+		if !isVersionRange(p.Version) {
+			continue
+		}
+
+		// plugins of the same module ask for the same range
+		if version, found := resolved[p.ModulePath]; found {
+			plugins[i].Range = p.Version
+			plugins[i].Version = version
+			continue
+		}
+
+		var version string
+		if locked, found := lockedPlugin(lock, p.ModulePath); found {
+			version = locked.Version
+		} else {
+			available, err := env.listModuleVersions(ctx, rangeModulePath(p.ModulePath, p.Version))
+			if err != nil {
+				return err
+			}
+			if env.dryRun {
+				logInfo("Plugin %s@%s would be resolved to the highest version satisfying it", p.ModulePath, p.Version)
+				continue
+			}
+
+			version, err = highestSatisfying(p.Version, available)
+			if err != nil {
+				return fmt.Errorf("plugin %s: %v", p.ModulePath, err)
+			}
+		}
+
+		logInfo("Resolved plugin %s@%s to version %s", p.ModulePath, p.Version, version)
+		resolved[p.ModulePath] = version
+		plugins[i].Range = p.Version
+		plugins[i].Version = version
+	}
+
+	env.plugins = plugins
+	return nil
+}
+
+func lockedPlugin(lock *lockFile, modulePath string) (lockedModule, bool) {
+	if lock == nil {
+		return lockedModule{}, false
+	}
+	return lock.findPlugin(modulePath)
+}
+
+var rangeMajorRegexp = regexp.MustCompile(`\d+`)
+
+var upperBoundRegexp = regexp.MustCompile(`^\s*(<|!=)`)
+
+// rangeModulePath returns the module path where the versions of the range are published,
+// which has the major version suffix when the range starts above v1.
+// Ranges starting with an upper bound, like <3.0.0, don't tell their major version,
+// so the module path must have the suffix already.
+func rangeModulePath(modulePath string, versionRange string) string {
+	if moduleVersionRegexp.MatchString(modulePath) || upperBoundRegexp.MatchString(versionRange) {
+		return modulePath
+	}
+
+	major, err := strconv.Atoi(rangeMajorRegexp.FindString(versionRange))
+	if err != nil || major <= 1 {
+		return modulePath
+	}
+	return fmt.Sprintf("%s/v%d", modulePath, major)
+}
+
+// listModuleVersions returns the tagged versions of the module known by the module proxy.
+// It lists nothing in dry run.
+func (e *environment) listModuleVersions(ctx context.Context, modulePath string) ([]string, error) {
+	var out bytes.Buffer
+	cmd := e.NewCommand("go", "list", "-m", "-versions", "-json", modulePath)
+	// the workspace is not open yet, running outside of any module keeps
+	// the go.mod of the current directory from interfering
+	cmd.Dir = os.TempDir()
+
+	err := e.RunCommand(ctx, cmd, &out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the versions of %s: %v", modulePath, err)
+	}
+	if e.dryRun {
+		return nil, nil
+	}
+
+	var m struct {
+		Versions []string
+	}
+	err = json.Unmarshal(out.Bytes(), &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Versions, nil
+}
+
+func highestSatisfying(versionRange string, available []string) (string, error) {
+	c, err := semver.NewConstraint(versionRange)
+	if err != nil {
+		return "", fmt.Errorf("invalid version range %s: %v", versionRange, err)
+	}
+
+	var highest *semver.Version
+	var picked string
+	for _, a := range available {
+		v, err := semver.NewVersion(a)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if highest == nil || v.GreaterThan(highest) {
+			highest = v
+			picked = a
+		}
+	}
+
+	if len(available) == 0 {
+		return "", fmt.Errorf("no tagged version is available to satisfy %s", versionRange)
+	}
+	if highest == nil {
+		return "", fmt.Errorf("no version satisfies %s among %s", versionRange, strings.Join(available, ", "))
+	}
+	return picked, nil
+}
+
+// versionSatisfies reports if the version is the requested one or, when a range was requested, if it satisfies the range.
+func versionSatisfies(requested string, version string) bool {
+	if !isVersionRange(requested) {
+		return requested == version
+	}
+
+	c, err := semver.NewConstraint(requested)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
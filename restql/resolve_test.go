@@ -0,0 +1,125 @@
+package restql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestIsVersionRange(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected bool
+	}{
+		{"^1.4", true},
+		{"~1.4.0", true},
+		{"1.4.x", true},
+		{">=1.4.0, <2.0.0", true},
+		{">=1.4.0", true},
+		{"<2.0.0", true},
+		{"> 1.4.0", true},
+		{"=1.4.2", true},
+		{"!=1.4.3", true},
+		{"v1.4.2", false},
+		{"v0.0.0-20210101000000-abcdefabcdef", false},
+		{"master", false},
+		{"fix", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got := isVersionRange(tt.version)
+			if got != tt.expected {
+				t.Fatalf("got = %v, want = %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHighestSatisfying(t *testing.T) {
+	available := []string{"v1.3.9", "v1.4.0", "v1.4.2", "v1.5.0", "v1.6.0-beta.1", "v2.0.0"}
+
+	tests := []struct {
+		versionRange string
+		expected     string
+		expectError  bool
+	}{
+		{"^1.4", "v1.5.0", false},
+		{"~1.4.0", "v1.4.2", false},
+		{"1.4.x", "v1.4.2", false},
+		{">=1.4.0, <1.5.0", "v1.4.2", false},
+		{"<v1.5.0", "v1.4.2", false},
+		{"^3.0", "", true},
+		{"not a range", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.versionRange, func(t *testing.T) {
+			got, err := highestSatisfying(tt.versionRange, available)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("got error = %v, expect error = %v", err, tt.expectError)
+			}
+			if got != tt.expected {
+				t.Fatalf("got = %s, want = %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRangeModulePath(t *testing.T) {
+	tests := []struct {
+		modulePath   string
+		versionRange string
+		expected     string
+	}{
+		{"github.com/user/plugin", "^1.4", "github.com/user/plugin"},
+		{"github.com/user/plugin", "~2.1.0", "github.com/user/plugin/v2"},
+		{"github.com/user/plugin/v3", "^3.0", "github.com/user/plugin/v3"},
+		{"github.com/user/plugin", ">=2.1.0", "github.com/user/plugin/v2"},
+		{"github.com/user/plugin", "<2.0.0", "github.com/user/plugin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.versionRange, func(t *testing.T) {
+			got := rangeModulePath(tt.modulePath, tt.versionRange)
+			if got != tt.expected {
+				t.Fatalf("got = %s, want = %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolvePluginVersionsFromLock(t *testing.T) {
+	env := newEnvironment("", []plugin{{ModulePath: "github.com/user/plugin", Version: "^1.4"}}, "v6.2.0")
+	lock := &lockFile{Plugins: []lockedModule{{Path: "github.com/user/plugin", Range: "^1.4", Version: "v1.4.2"}}}
+
+	err := resolvePluginVersions(context.Background(), env, lock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := env.plugins[0]
+	if got.Version != "v1.4.2" || got.Range != "^1.4" {
+		t.Fatalf("unexpected plugin: %+v", got)
+	}
+}
+
+func TestResolvePluginVersionsInDryRun(t *testing.T) {
+	env := newEnvironment("", []plugin{{ModulePath: "github.com/user/plugin", Version: ">=1.4.0"}}, "v6.2.0")
+	env.DryRun()
+
+	err := resolvePluginVersions(context.Background(), env, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := env.plugins[0].Version; got != ">=1.4.0" {
+		t.Fatalf("got = %s, want = >=1.4.0", got)
+	}
+
+	want := []string{"go", "list", "-m", "-versions", "-json", "github.com/user/plugin"}
+	if len(env.plannedCommands) != 1 || !reflect.DeepEqual(env.plannedCommands[0].args, want) {
+		t.Fatalf("got = %+v, want = %v", env.plannedCommands, want)
+	}
+}
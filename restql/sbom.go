@@ -0,0 +1,342 @@
+package restql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	sbomCycloneDX = "cyclonedx"
+	sbomSPDX      = "spdx"
+)
+
+const (
+	roleRestql     = "restql"
+	rolePlugin     = "plugin"
+	roleDependency = "dependency"
+)
+
+// sbomComponent is a module linked into the binary, with the "h1:" hash go.sum records for it.
+//
+// That hash is a SHA-256 of the list of files in the module and their own SHA-256,
+// not of the module zip, so it is reported as a Go property instead of a checksum.
+type sbomComponent struct {
+	Path    string
+	Version string
+	GoSumH1 string
+	Replace string
+	Role    string
+}
+
+func (c sbomComponent) purl() string {
+	return fmt.Sprintf("pkg:golang/%s@%s", c.Path, c.Version)
+}
+
+// sbomExtension returns the suffix added to the binary name for the SBOM file of the given format.
+func sbomExtension(format string) (string, error) {
+	switch format {
+	case sbomCycloneDX:
+		return ".cdx.json", nil
+	case sbomSPDX:
+		return ".spdx.json", nil
+	default:
+		return "", fmt.Errorf("unknown SBOM format %q, expected %s or %s", format, sbomCycloneDX, sbomSPDX)
+	}
+}
+
+// writeSBOM walks the module graph of the environment and writes it as a bill of materials in the given format.
+func writeSBOM(ctx context.Context, env *environment, format string, location string) error {
+	components, err := collectSBOMComponents(ctx, env)
+	if err != nil || env.dryRun {
+		return err
+	}
+
+	serial, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	subject := sbomComponent{Path: "restql", Version: env.restqlModuleVersion}
+	now := time.Now().UTC()
+
+	var document interface{}
+	switch format {
+	case sbomCycloneDX:
+		document = newCycloneDXDocument(subject, components, serial, now)
+	case sbomSPDX:
+		document = newSPDXDocument(subject, components, serial, now)
+	default:
+		_, err := sbomExtension(format)
+		return err
+	}
+
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+
+	logInfo("Writing SBOM to: %s", location)
+	return ioutil.WriteFile(location, content, 0644)
+}
+
+func collectSBOMComponents(ctx context.Context, env *environment) ([]sbomComponent, error) {
+	modules, err := env.ListModules(ctx)
+	if err != nil || env.dryRun {
+		return nil, err
+	}
+
+	goSum, err := ioutil.ReadFile(filepath.Join(env.dir, "go.sum"))
+	if err != nil {
+		return nil, err
+	}
+	sums := parseGoSum(goSum)
+
+	restqlMod, err := versionedModulePath(env.restqlModulePath, env.restqlModuleVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginMods := make(map[string]bool, len(env.plugins))
+	for _, p := range env.plugins {
+		pluginMod, err := versionedModulePath(p.ModulePath, p.Version)
+		if err != nil {
+			return nil, err
+		}
+		pluginMods[pluginMod] = true
+	}
+
+	var components []sbomComponent
+	for _, m := range modules {
+		if m.Main {
+			continue
+		}
+
+		c := sbomComponent{Path: m.Path, Version: m.Version, Role: roleDependency}
+		switch {
+		case m.Path == restqlMod:
+			c.Role = roleRestql
+		case pluginMods[m.Path]:
+			c.Role = rolePlugin
+		}
+
+		sumKey := m.Path + " " + m.Version
+		if m.Replace != nil {
+			c.Replace = m.Replace.Path
+			if m.Replace.Version != "" {
+				c.Replace += "@" + m.Replace.Version
+				sumKey = m.Replace.Path + " " + m.Replace.Version
+			}
+		}
+
+		c.GoSumH1 = goSumH1(sums[sumKey])
+		components = append(components, c)
+	}
+
+	return components, nil
+}
+
+// goSumH1 returns the base64 encoded digest of a go.sum "h1:" hash, or an empty string for other kinds of hash.
+func goSumH1(hash string) string {
+	if !strings.HasPrefix(hash, "h1:") {
+		return ""
+	}
+	return strings.TrimPrefix(hash, "h1:")
+}
+
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version"`
+	PURL       string              `json:"purl,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func newCycloneDXDocument(subject sbomComponent, components []sbomComponent, serial string, now time.Time) cycloneDXDocument {
+	doc := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + serial,
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: now.Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: "restql-cli"}},
+			Component: cycloneDXComponent{
+				Type:    "application",
+				BOMRef:  subject.Path,
+				Name:    subject.Path,
+				Version: subject.Version,
+			},
+		},
+	}
+
+	root := cycloneDXDependency{Ref: subject.Path, DependsOn: []string{}}
+	for _, c := range components {
+		cc := cycloneDXComponent{
+			Type:       "library",
+			BOMRef:     c.purl(),
+			Name:       c.Path,
+			Version:    c.Version,
+			PURL:       c.purl(),
+			Properties: []cycloneDXProperty{{Name: "restql:role", Value: c.Role}},
+		}
+		if c.GoSumH1 != "" {
+			cc.Properties = append(cc.Properties, cycloneDXProperty{Name: "go:h1", Value: c.GoSumH1})
+		}
+		if c.Replace != "" {
+			cc.Properties = append(cc.Properties, cycloneDXProperty{Name: "restql:replace", Value: c.Replace})
+		}
+
+		doc.Components = append(doc.Components, cc)
+		root.DependsOn = append(root.DependsOn, cc.BOMRef)
+	}
+	doc.Dependencies = []cycloneDXDependency{root}
+
+	return doc
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func newSPDXDocument(subject sbomComponent, components []sbomComponent, serial string, now time.Time) spdxDocument {
+	name := fmt.Sprintf("%s-%s", subject.Path, subject.Version)
+	rootID := "SPDXRef-Package-restql"
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://github.com/americanas-tech/restQL-cli/spdx/%s-%s", name, serial),
+		CreationInfo: spdxCreationInfo{
+			Created:  now.Format(time.RFC3339),
+			Creators: []string{"Tool: restql-cli"},
+		},
+		Packages: []spdxPackage{{
+			Name:             subject.Path,
+			SPDXID:           rootID,
+			VersionInfo:      subject.Version,
+			DownloadLocation: "NOASSERTION",
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: rootID,
+		}},
+	}
+
+	for i, c := range components {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		p := spdxPackage{
+			Name:             c.Path,
+			SPDXID:           id,
+			VersionInfo:      c.Version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.purl(),
+			}},
+			Comment: "restql:role=" + c.Role,
+		}
+		if c.Replace != "" {
+			p.Comment += " restql:replace=" + c.Replace
+		}
+		if c.GoSumH1 != "" {
+			p.Comment += " go:h1=" + c.GoSumH1
+		}
+
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      rootID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return doc
+}
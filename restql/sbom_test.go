@@ -0,0 +1,72 @@
+package restql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGoSumH1(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"when given a h1 hash, return its digest",
+			"h1:3cNq/LC4xdELEhPsoJCyrSIlo1FxMr6t3Xl2XCQwY5U=",
+			"3cNq/LC4xdELEhPsoJCyrSIlo1FxMr6t3Xl2XCQwY5U=",
+		},
+		{
+			"when given an empty hash, return an empty string",
+			"",
+			"",
+		},
+		{
+			"when given an unknown hash kind, return an empty string",
+			"h2:abc",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := goSumH1(tt.input)
+			if got != tt.expected {
+				t.Fatalf("got = %s, want = %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewSBOMDocuments(t *testing.T) {
+	subject := sbomComponent{Path: "restql", Version: "v6.2.0"}
+	components := []sbomComponent{
+		{Path: "github.com/b2wdigital/restQL-golang/v6", Version: "v6.2.0", GoSumH1: "abc=", Role: roleRestql},
+		{Path: "github.com/user/plugin", Version: "v1.0.0", Replace: "/plugin", Role: rolePlugin},
+	}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cdx := newCycloneDXDocument(subject, components, "serial", now)
+	if len(cdx.Components) != 2 || cdx.Components[0].PURL != "pkg:golang/github.com/b2wdigital/restQL-golang/v6@v6.2.0" {
+		t.Fatalf("unexpected CycloneDX components: %+v", cdx.Components)
+	}
+	expectedProperties := []cycloneDXProperty{{Name: "restql:role", Value: roleRestql}, {Name: "go:h1", Value: "abc="}}
+	if !reflect.DeepEqual(cdx.Components[0].Properties, expectedProperties) || len(cdx.Components[1].Properties) != 2 {
+		t.Fatalf("unexpected CycloneDX properties: %+v", cdx.Components)
+	}
+	if len(cdx.Dependencies) != 1 || len(cdx.Dependencies[0].DependsOn) != 2 {
+		t.Fatalf("unexpected CycloneDX dependencies: %+v", cdx.Dependencies)
+	}
+
+	spdx := newSPDXDocument(subject, components, "serial", now)
+	if len(spdx.Packages) != 3 || len(spdx.Relationships) != 3 {
+		t.Fatalf("unexpected SPDX document: %+v", spdx)
+	}
+	if spdx.Packages[1].Comment != "restql:role=restql go:h1=abc=" {
+		t.Fatalf("unexpected SPDX restQL comment: %s", spdx.Packages[1].Comment)
+	}
+	if spdx.Packages[2].Comment != "restql:role=plugin restql:replace=/plugin" {
+		t.Fatalf("unexpected SPDX plugin comment: %s", spdx.Packages[2].Comment)
+	}
+}
@@ -0,0 +1,273 @@
+package restql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pluginRegistration is what a plugin package registers in restQL, found by reading its source.
+type pluginRegistration struct {
+	importPath string
+	names      []string
+	types      []string
+	hooks      []string
+}
+
+type goPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	GoFiles    []string
+	Imports    []string
+	Deps       []string
+	Module     *goModule
+}
+
+// validatePlugins reads the source of every plugin package in the prepared environment and
+// fails if any of them does not call the restQL registration function inside an init function.
+// The name, type and lifecycle hooks of each registered plugin are reported, and then the order
+// they register in is checked. Nothing is checked when the environment skips the validation.
+func validatePlugins(ctx context.Context, env *environment) error {
+	if env.skipValidation {
+		logWarn("Skipping the validation of the plugins, they are not checked to register in restQL")
+		return nil
+	}
+
+	restqlMod, err := versionedModulePath(env.restqlModulePath, env.restqlModuleVersion)
+	if err != nil {
+		return err
+	}
+	api := env.adapter.pluginAPI
+	apiPackage := restqlMod + "/" + api.packagePath
+
+	packages, err := env.listProgramPackages(ctx)
+	if err != nil || env.dryRun {
+		return err
+	}
+	byPath := make(map[string]goPackage, len(packages))
+	for _, pkg := range packages {
+		byPath[pkg.ImportPath] = pkg
+	}
+
+	var registrations []pluginRegistration
+	var unregistered []string
+	for _, importPath := range pluginImportPaths(env.plugins) {
+		pkg, found := byPath[importPath]
+		if !found {
+			return fmt.Errorf("plugin package %s is not part of the program", importPath)
+		}
+
+		r, err := findPluginRegistration(pkg, apiPackage, api)
+		if err != nil {
+			return err
+		}
+
+		if len(r.names) == 0 {
+			unregistered = append(unregistered, r.importPath)
+			continue
+		}
+
+		hooks := "none"
+		if len(r.hooks) > 0 {
+			hooks = strings.Join(r.hooks, ", ")
+		}
+		logInfo("Plugin %s registers %s of type %s, implementing hooks: %s",
+			r.importPath, strings.Join(r.names, ", "), strings.Join(r.types, ", "), hooks)
+		registrations = append(registrations, r)
+	}
+
+	if len(unregistered) > 0 {
+		return fmt.Errorf("no init function calls %s.%s in the plugins: %s", apiPackage, api.registerFunction, strings.Join(unregistered, ", "))
+	}
+
+	return checkPluginOrder(ctx, env, packages, registrations)
+}
+
+// listProgramPackages lists the main package of the environment and every package it depends on.
+func (e *environment) listProgramPackages(ctx context.Context) ([]goPackage, error) {
+	var out bytes.Buffer
+	args := append([]string{"list", "-deps", "-json"}, e.orderArgs()...)
+	cmd := e.NewCommand("go", append(args, ".")...)
+	err := e.RunCommand(ctx, cmd, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []goPackage
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var p goPackage
+		err := decoder.Decode(&p)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+
+	return packages, nil
+}
+
+func findPluginRegistration(pkg goPackage, apiPackage string, api pluginAPI) (pluginRegistration, error) {
+	r := pluginRegistration{importPath: pkg.ImportPath}
+	fset := token.NewFileSet()
+
+	var files []*ast.File
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, 0)
+		if err != nil {
+			return pluginRegistration{}, err
+		}
+		files = append(files, f)
+	}
+
+	consts := packageStringConstants(files)
+	hooks := make(map[string]bool, len(api.hooks))
+	for _, h := range api.hooks {
+		hooks[h] = true
+	}
+
+	for _, f := range files {
+		apiName, imported := importName(f, apiPackage)
+
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+
+			if fn.Recv != nil && hooks[fn.Name.Name] {
+				hooks[fn.Name.Name] = false
+				r.hooks = append(r.hooks, fn.Name.Name)
+			}
+
+			if fn.Recv != nil || fn.Name.Name != "init" || !imported || fn.Body == nil {
+				continue
+			}
+
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || !isSelector(call.Fun, apiName, api.registerFunction) {
+					return true
+				}
+
+				name, pluginType := describeRegistration(call, consts)
+				r.names = append(r.names, name)
+				r.types = append(r.types, pluginType)
+				return true
+			})
+		}
+	}
+
+	return r, nil
+}
+
+// importName returns the name the file uses for the imported package.
+func importName(f *ast.File, importPath string) (string, bool) {
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || path != importPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name, true
+		}
+		return filepath.Base(path), true
+	}
+	return "", false
+}
+
+func isSelector(expr ast.Expr, pkgName string, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == pkgName && sel.Sel.Name == name
+}
+
+// describeRegistration extracts the Name and Type fields of the plugin information given to the registration,
+// when they are written in the call itself.
+func describeRegistration(call *ast.CallExpr, consts map[string]string) (string, string) {
+	name, pluginType := "unknown", "unknown"
+	if len(call.Args) != 1 {
+		return name, pluginType
+	}
+
+	info, ok := call.Args[0].(*ast.CompositeLit)
+	if !ok {
+		return name, pluginType
+	}
+
+	for _, elt := range info.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		switch key.Name {
+		case "Name":
+			if v, ok := stringValue(kv.Value, consts); ok {
+				name = v
+			}
+		case "Type":
+			if sel, ok := kv.Value.(*ast.SelectorExpr); ok {
+				pluginType = strings.TrimSuffix(sel.Sel.Name, "PluginType")
+			}
+		}
+	}
+
+	return name, pluginType
+}
+
+func stringValue(expr ast.Expr, consts map[string]string) (string, bool) {
+	switch v := expr.(type) {
+	case *ast.BasicLit:
+		if v.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(v.Value)
+		return s, err == nil
+	case *ast.Ident:
+		s, ok := consts[v.Name]
+		return s, ok
+	}
+	return "", false
+}
+
+// packageStringConstants collects the package level constants assigned to string literals.
+func packageStringConstants(files []*ast.File) map[string]string {
+	consts := make(map[string]string)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, n := range vs.Names {
+					if i >= len(vs.Values) {
+						break
+					}
+					if s, ok := stringValue(vs.Values[i], nil); ok {
+						consts[n.Name] = s
+					}
+				}
+			}
+		}
+	}
+	return consts
+}
@@ -0,0 +1,107 @@
+package restql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindPluginRegistration(t *testing.T) {
+	apiPackage := "github.com/b2wdigital/restQL-golang/v6/pkg/restql"
+
+	tests := []struct {
+		name     string
+		source   string
+		expected pluginRegistration
+	}{
+		{
+			name: "when the init registers a plugin, its name, type and hooks are found",
+			source: `package plugin
+
+import "github.com/b2wdigital/restQL-golang/v6/pkg/restql"
+
+func init() {
+	restql.RegisterPlugin(restql.PluginInfo{Name: "my-plugin", Type: restql.LifecyclePluginType, New: New})
+}
+
+type Plugin struct{}
+
+func (p Plugin) BeforeTransaction() {}
+func (p Plugin) AfterQuery()        {}
+func (p Plugin) Helper()            {}
+`,
+			expected: pluginRegistration{names: []string{"my-plugin"}, types: []string{"Lifecycle"}, hooks: []string{"BeforeTransaction", "AfterQuery"}},
+		},
+		{
+			name: "when the plugin name is a constant and the package is aliased, it is found",
+			source: `package plugin
+
+import rql "github.com/b2wdigital/restQL-golang/v6/pkg/restql"
+
+const pluginName = "aliased"
+
+func init() {
+	rql.RegisterPlugin(rql.PluginInfo{Name: pluginName, Type: rql.DatabasePluginType})
+}
+`,
+			expected: pluginRegistration{names: []string{"aliased"}, types: []string{"Database"}},
+		},
+		{
+			name: "when the registration is outside an init, nothing is registered",
+			source: `package plugin
+
+import "github.com/b2wdigital/restQL-golang/v6/pkg/restql"
+
+func Register() {
+	restql.RegisterPlugin(restql.PluginInfo{Name: "late"})
+}
+`,
+			expected: pluginRegistration{},
+		},
+		{
+			name: "when another restQL major version is registered, nothing is registered",
+			source: `package plugin
+
+import "github.com/b2wdigital/restQL-golang/v4/pkg/restql"
+
+func init() {
+	restql.RegisterPlugin(restql.PluginInfo{Name: "old"})
+}
+`,
+			expected: pluginRegistration{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "plugin.go"), []byte(tt.source), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pkg := goPackage{ImportPath: "github.com/user/plugin", Dir: dir, GoFiles: []string{"plugin.go"}}
+			got, err := findPluginRegistration(pkg, apiPackage, restqlPluginAPI)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			tt.expected.importPath = pkg.ImportPath
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("got = %+v, want = %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidatePluginsSkipped(t *testing.T) {
+	env := newEnvironment(t.TempDir(), []plugin{{ModulePath: "github.com/user/plugin-a"}}, "v6.2.0")
+	env.SkipPluginValidation()
+
+	err := validatePlugins(context.Background(), env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package restql
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// devBinary is the name of the restQL binary built inside the environment in watch mode.
+const devBinary = "restql-dev"
+
+// nextDevBinary is where restQL is built while the previous build is still running.
+const nextDevBinary = "restql-dev-next"
+
+// watchInterval is how often the watched files are checked for changes.
+var watchInterval = 500 * time.Millisecond
+
+// watchDebounce is how long the watched files must stay unchanged after a change before
+// restQL is rebuilt, so saving several files at once causes a single rebuild.
+var watchDebounce = 300 * time.Millisecond
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileSnapshot records the state of the watched files by their path.
+type fileSnapshot map[string]fileState
+
+// isWatchedFile reports if changes to the file require restQL to be rebuilt.
+func isWatchedFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".go", ".yml", ".yaml":
+		return true
+	}
+	return name == "go.mod"
+}
+
+// snapshotFiles records the watched files inside the directories, skipping hidden and vendor
+// directories, like the environment of the run. Files given directly are always recorded.
+func snapshotFiles(locations []string) (fileSnapshot, error) {
+	snapshot := make(fileSnapshot)
+
+	for _, location := range locations {
+		err := filepath.WalkDir(location, func(path string, d fs.DirEntry, err error) error {
+			// files can be removed while being walked
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				if path != location && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if path != location && !isWatchedFile(d.Name()) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			snapshot[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// changes lists the files created, modified or removed in the other snapshot.
+func (s fileSnapshot) changes(other fileSnapshot) []string {
+	var changed []string
+	for path, state := range other {
+		if previous, ok := s[path]; !ok || previous != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range s {
+		if _, ok := other[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+// waitForChanges polls the locations until their files change and then stay unchanged for
+// the debounce duration, returning the new snapshot and every file changed since the previous one.
+// It returns the context error when the context is done first.
+func waitForChanges(ctx context.Context, locations []string, previous fileSnapshot) (fileSnapshot, []string, error) {
+	interval := watchInterval
+	var changed fileSnapshot
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		current, err := snapshotFiles(locations)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if changed == nil {
+			if len(previous.changes(current)) > 0 {
+				changed = current
+				interval = watchDebounce
+			}
+			continue
+		}
+
+		if len(changed.changes(current)) > 0 {
+			changed = current
+			continue
+		}
+
+		return current, previous.changes(current), nil
+	}
+}
+
+// watchAndRun validates the plugins and runs the restQL built from the environment and, whenever
+// the watched files change, does it again and restarts it. When the validation or the build fails,
+// the running restQL is kept, or none is started, until the files change.
+func watchAndRun(ctx context.Context, env *environment, locations []string, race bool) error {
+	snapshot, err := snapshotFiles(locations)
+	if err != nil {
+		return err
+	}
+	logInfo("Watching for changes in: %s", strings.Join(locations, ", "))
+
+	var running *process
+	defer func() {
+		if running != nil {
+			running.stop()
+		}
+	}()
+
+	err = rebuildDevBinary(ctx, env, nil, race)
+	if err == nil {
+		running, err = restartDevBinary(env, running)
+	}
+	if err != nil && ctx.Err() == nil {
+		logError("Failed to start restQL, waiting for changes: %v", err)
+	}
+
+	for {
+		var changed []string
+		snapshot, changed, err = waitForChanges(ctx, locations, snapshot)
+		if ctx.Err() != nil {
+			if running != nil {
+				running.stop()
+				running = nil
+			}
+			logInfo("restQL stopped")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		logInfo("Changes detected in: %s", strings.Join(changed, ", "))
+		err = rebuildDevBinary(ctx, env, changed, race)
+		if ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			logError("Rebuild failed, restQL was not restarted: %v", err)
+			continue
+		}
+
+		running, err = restartDevBinary(env, running)
+		if err != nil {
+			logError("Failed to restart restQL: %v", err)
+		}
+	}
+}
+
+// buildDevBinary builds restQL next to the binary in use, which is replaced once the running restQL is stopped.
+func buildDevBinary(ctx context.Context, env *environment, race bool) error {
+	args := []string{"build", "-o", executableName(nextDevBinary)}
+	if race {
+		args = append(args, "-race")
+	}
+	cmd := env.NewCommand("go", append(args, ".")...)
+	return env.RunCommand(ctx, cmd, os.Stdout)
+}
+
+// rebuildDevBinary updates the requirements of the environment when a go.mod changed,
+// validates the plugins and builds restQL again.
+func rebuildDevBinary(ctx context.Context, env *environment, changed []string, race bool) error {
+	for _, path := range changed {
+		if filepath.Base(path) != "go.mod" {
+			continue
+		}
+
+		cmd := env.NewCommand("go", "mod", "tidy")
+		err := env.RunCommand(ctx, cmd, os.Stdout)
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	err := validatePlugins(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	return buildDevBinary(ctx, env, race)
+}
+
+// executableName adds the extension Windows requires to run the binary.
+func executableName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// restartDevBinary stops the running restQL, if any, and starts the newly built one.
+func restartDevBinary(env *environment, running *process) (*process, error) {
+	if running != nil {
+		running.stop()
+	}
+
+	binary := filepath.Join(env.dir, executableName(devBinary))
+	err := os.Rename(filepath.Join(env.dir, executableName(nextDevBinary)), binary)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := env.NewCommand(binary)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	logInfo("Starting restQL: %s", binary)
+	p, err := startProcess(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-p.exited
+		select {
+		case <-p.stopping:
+		default:
+			logWarn("restQL exited, waiting for changes: %v", p.err)
+		}
+	}()
+
+	return p, nil
+}
@@ -0,0 +1,130 @@
+package restql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsWatchedFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"plugin.go", true},
+		{"go.mod", true},
+		{"restql.yml", true},
+		{"restql.yaml", true},
+		{"go.sum", false},
+		{"README.md", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isWatchedFile(tt.name)
+			if got != tt.expected {
+				t.Fatalf("got = %t, want = %t", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSnapshotFilesChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "plugin.go"), "package plugin")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "# plugin")
+	writeTestFile(t, filepath.Join(dir, ".restql-env", "main.go"), "package main")
+	writeTestFile(t, filepath.Join(dir, "vendor", "lib", "lib.go"), "package lib")
+	config := filepath.Join(t.TempDir(), "restql.conf")
+	writeTestFile(t, config, "mappings: {}")
+
+	before, err := snapshotFiles([]string{dir, config, filepath.Join(dir, "missing.yml")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedFiles := []string{filepath.Join(dir, "plugin.go"), config}
+	if got := (fileSnapshot{}).changes(before); !reflect.DeepEqual(got, expectedFiles) {
+		t.Fatalf("got = %v, want = %v", got, expectedFiles)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "plugin.go"), "package plugin // changed")
+	writeTestFile(t, filepath.Join(dir, "go.mod"), "module github.com/user/plugin")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "# changed")
+	err = os.Remove(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	after, err := snapshotFiles([]string{dir, config})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedChanges := []string{filepath.Join(dir, "go.mod"), filepath.Join(dir, "plugin.go"), config}
+	if got := before.changes(after); !reflect.DeepEqual(got, expectedChanges) {
+		t.Fatalf("got = %v, want = %v", got, expectedChanges)
+	}
+}
+
+func TestWaitForChangesDebounces(t *testing.T) {
+	interval, debounce := watchInterval, watchDebounce
+	defer func() { watchInterval, watchDebounce = interval, debounce }()
+	watchInterval, watchDebounce = 10*time.Millisecond, 100*time.Millisecond
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	writeTestFile(t, first, "package plugin")
+
+	previous, err := snapshotFiles([]string{dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// both files are saved within the debounce duration, so they are reported together
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(first, []byte("package plugin // changed"), 0644)
+		time.Sleep(30 * time.Millisecond)
+		_ = os.WriteFile(second, []byte("package plugin"), 0644)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, changed, err := waitForChanges(ctx, []string{dir}, previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{first, second}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Fatalf("got = %v, want = %v", changed, expected)
+	}
+}
+
+func TestWaitForChangesStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := waitForChanges(ctx, []string{t.TempDir()}, fileSnapshot{})
+	if err != context.Canceled {
+		t.Fatalf("got = %v, want = %v", err, context.Canceled)
+	}
+}
+
+func writeTestFile(t *testing.T, location string, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(location), 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = os.WriteFile(location, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package restql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// workspacePattern names the temporary directories where restQL is compiled when the cache is not used.
+const workspacePattern = "restql-compiling-*"
+
+// abandonedWorkspaceAge is how old a temporary workspace must be to be considered left behind by an earlier build.
+const abandonedWorkspaceAge = 24 * time.Hour
+
+// reportedOutputLines limits how much of the failing command output is repeated in the failure report.
+const reportedOutputLines = 30
+
+// commandError is returned when a command executed in the environment fails, keeping what it wrote to stderr.
+type commandError struct {
+	args   []string
+	dir    string
+	stderr string
+	err    error
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("failed to execute command %s: %v", formatCommand(e.args), e.err)
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// releaseWorkspace runs when the build finishes. The temporary workspace is removed,
+// unless the build failed or it was asked to be kept, and the use of a cached one is recorded.
+//
+// An interrupted build is not kept for inspection: its temporary workspace is removed, and so
+// is a cache entry it did not finish preparing.
+func releaseWorkspace(ctx context.Context, env *environment, cache *cacheEntry, keep bool, buildErr error) {
+	if cache != nil {
+		defer cache.Unlock()
+	}
+
+	if buildErr != nil && ctx.Err() != nil {
+		logWarn("Build interrupted")
+		if keep {
+			logInfo("Build workspace kept at: %s", env.dir)
+			return
+		}
+		if cache == nil || !cache.Prepared() {
+			cleanWorkspace(env)
+		}
+		return
+	}
+
+	if buildErr != nil {
+		reportFailure(env.dir, buildErr)
+		return
+	}
+
+	if cache != nil {
+		err := cache.Touch()
+		if err != nil {
+			logError("An error occurred when updating the cache: %v", err)
+		}
+	}
+
+	if keep {
+		logInfo("Build workspace kept at: %s", env.dir)
+	}
+	if keep || cache != nil {
+		return
+	}
+
+	cleanWorkspace(env)
+}
+
+func cleanWorkspace(env *environment) {
+	err := env.Clean()
+	if err != nil {
+		logError("An error occurred when cleaning: %v", err)
+	}
+}
+
+// reportFailure tells where the workspace of a failed build was kept
+// and, when a command failed, which one and what it wrote to stderr.
+func reportFailure(dir string, err error) {
+	logError("Build failed, the workspace was kept at: %s", dir)
+
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) {
+		return
+	}
+
+	logError("Failing command: (cd %s && %s)", cmdErr.dir, formatCommand(cmdErr.args))
+	if output := lastLines(cmdErr.stderr, reportedOutputLines); output != "" {
+		logError("Command output:\n%s", output)
+	}
+}
+
+// lastLines returns at most n lines from the end of the text.
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cleanAbandonedWorkspaces removes the temporary workspaces inside dir that were
+// not modified in the given duration, left behind by failed or interrupted builds.
+func cleanAbandonedWorkspaces(dir string, olderThan time.Duration) error {
+	workspaces, err := filepath.Glob(filepath.Join(dir, workspacePattern))
+	if err != nil {
+		return err
+	}
+
+	threshold := time.Now().Add(-olderThan)
+	for _, w := range workspaces {
+		info, err := os.Stat(w)
+		if err != nil || !info.IsDir() || info.ModTime().After(threshold) {
+			continue
+		}
+
+		logInfo("Removing abandoned workspace: %s", w)
+		err = os.RemoveAll(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package restql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLastLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		n        int
+		expected string
+	}{
+		{"fewer lines than the limit", "a\nb\n", 3, "a\nb"},
+		{"more lines than the limit", "a\nb\nc\nd\n", 2, "c\nd"},
+		{"empty text", "", 2, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lastLines(tt.text, tt.n)
+			if got != tt.expected {
+				t.Fatalf("got = %q, want = %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCommandErrorIsFoundWhenWrapped(t *testing.T) {
+	env := newEnvironment(t.TempDir(), nil, "")
+	err := env.RunCommand(context.Background(), exec.Command("go", "not-a-command"), nil)
+	if err == nil {
+		t.Fatalf("expected command to fail")
+	}
+
+	var cmdErr *commandError
+	if !errors.As(fmt.Errorf("failed to build for platform linux/amd64: %w", err), &cmdErr) {
+		t.Fatalf("got = %v, want = a command error", err)
+	}
+	if cmdErr.stderr == "" {
+		t.Fatalf("got = empty stderr, want = the command output")
+	}
+}
+
+func TestCleanAbandonedWorkspaces(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "restql-compiling-old")
+	recent := filepath.Join(dir, "restql-compiling-recent")
+	unrelated := filepath.Join(dir, "unrelated-old")
+
+	for _, d := range []string{old, recent, unrelated} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	past := time.Now().Add(-48 * time.Hour)
+	for _, d := range []string{old, unrelated} {
+		if err := os.Chtimes(d, past, past); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	err := cleanAbandonedWorkspaces(dir, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]bool{old: false, recent: true, unrelated: true}
+	for d, exists := range expected {
+		_, err := os.Stat(d)
+		if got := err == nil; got != exists {
+			t.Fatalf("%s: got exists = %v, want = %v", d, got, exists)
+		}
+	}
+}
+
+func TestReleaseWorkspaceOfInterruptedBuild(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name           string
+		keep           bool
+		expectedExists bool
+	}{
+		{"when the build is interrupted, its temporary workspace is removed", false, false},
+		{"when the build is interrupted and asked to keep its workspace, it is kept", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "workspace")
+			err := os.Mkdir(dir, 0700)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			env := newEnvironment(dir, nil, "")
+			releaseWorkspace(ctx, env, nil, tt.keep, ctx.Err())
+
+			_, err = os.Stat(dir)
+			if exists := err == nil; exists != tt.expectedExists {
+				t.Fatalf("got = workspace exists %t, want = %t", exists, tt.expectedExists)
+			}
+		})
+	}
+}